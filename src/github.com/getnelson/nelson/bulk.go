@@ -0,0 +1,240 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// BulkOptions select the stacks a bulk operation applies to, the same
+// way stacks list does, and say how quickly to work through them.
+type BulkOptions struct {
+	Unit        string
+	Datacenters string
+	Namespaces  string
+	Statuses    string
+	Concurrency int
+	// stacks started per second; zero is unlimited
+	Rate float64
+}
+
+func (o BulkOptions) hasSelector() bool {
+	return len(o.Unit) > 0 || len(o.Datacenters) > 0 || len(o.Statuses) > 0
+}
+
+// the flags every bulk stack command takes; the namespaces come from
+// stackNamespaceFlag, which the single stack form shares.
+func bulkFlags(o *BulkOptions) []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "unit, u",
+			Usage:       "Act on every stack of this unit, instead of a single stack",
+			Destination: &o.Unit,
+		},
+		cli.StringFlag{
+			Name:        "datacenters, d",
+			Usage:       "Act on every stack in these comma delimited datacenters, instead of a single stack",
+			Destination: &o.Datacenters,
+		},
+		cli.StringFlag{
+			Name:        "statuses, status, s",
+			Usage:       "Act on every stack with one of these comma delimited statuses, instead of a single stack",
+			Destination: &o.Statuses,
+		},
+		cli.IntFlag{
+			Name:        "concurrency",
+			Value:       4,
+			Usage:       "How many stacks to act on at once",
+			Destination: &o.Concurrency,
+		},
+		cli.Float64Flag{
+			Name:        "rate",
+			Value:       1,
+			Usage:       "How many stacks to start acting on per second; 0 for no limit",
+			Destination: &o.Rate,
+		},
+	}
+}
+
+/*
+ * {
+ *   "guid": "b8ff485a0306",
+ *   "stack_name": "howdy-http--1-2-3--b8ff485a",
+ *   "succeeded": false,
+ *   "error": "POST https://nelson.yourcompany.com/v1/deployments/b8ff485a0306/redeploy: 500 Internal Server Error"
+ * }
+ */
+type BulkResult struct {
+	Guid      string `json:"guid"`
+	StackName string `json:"stack_name"`
+	Succeeded bool   `json:"succeeded"`
+	// the request was printed by a dry run instead of being sent
+	DryRun bool   `json:"dry_run,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RunBulk applies op to every stack, with at most concurrency in flight
+// and starting no more than rate a second, and returns a result for each
+// stack in the order given. done is told of each result as it completes.
+func RunBulk(ctx context.Context, stacks []client.Stack, concurrency int, rate float64, op func(context.Context, string) error, done func(BulkResult)) []BulkResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var tick <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	results := make([]BulkResult, len(stacks))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i, s := range stacks {
+		if i > 0 && tick != nil {
+			select {
+			case <-ctx.Done():
+			case <-tick:
+			}
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, s client.Stack) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r := BulkResult{Guid: s.Guid, StackName: s.StackName, Succeeded: true}
+			if err := ctx.Err(); err != nil {
+				r.Succeeded, r.Error = false, err.Error()
+			} else if err := op(ctx, s.Guid); err == client.ErrDryRun {
+				r.DryRun = true
+			} else if err != nil {
+				r.Succeeded, r.Error = false, err.Error()
+			}
+			results[i] = r
+			mu.Lock()
+			defer mu.Unlock()
+			done(r)
+		}(i, s)
+	}
+	wg.Wait()
+	return results
+}
+
+func countFailed(results []BulkResult) int {
+	failed := 0
+	for _, r := range results {
+		if !r.Succeeded {
+			failed++
+		}
+	}
+	return failed
+}
+
+func PrintBulkResult(verb string, r BulkResult) {
+	if r.DryRun {
+		fmt.Println("===>> " + verb + " " + r.Guid + " (" + r.StackName + "): dry run")
+	} else if r.Succeeded {
+		fmt.Println("===>> " + verb + " " + r.Guid + " (" + r.StackName + "): ok")
+	} else {
+		fmt.Println("===>> " + verb + " " + r.Guid + " (" + r.StackName + "): FAILED: " + r.Error)
+	}
+}
+
+func PrintBulkResults(results []BulkResult) {
+	var tabulized = [][]string{}
+	for _, r := range results {
+		result := "ok"
+		if r.DryRun {
+			result = "dry run"
+		} else if !r.Succeeded {
+			result = "failed: " + r.Error
+		}
+		tabulized = append(tabulized, []string{r.Guid, r.StackName, result})
+	}
+	fmt.Println("")
+	fmt.Println("===>> Summary: " + strconv.Itoa(len(results)-countFailed(results)) + " succeeded, " + strconv.Itoa(countFailed(results)) + " failed")
+	RenderTableToStdout([]string{"GUID", "Stack", "Result"}, tabulized)
+}
+
+// runs a bulk stack command end to end: selects the stacks, shows them,
+// asks for confirmation, acts on each with op and reports. verb names
+// the action, e.g. "redeploy".
+func bulkStackAction(ctx context.Context, cfg *Config, o BulkOptions, verb string, assumeYes bool, op func(context.Context, *client.Client, string) error) error {
+	for name, list := range map[string]string{"datacenters": o.Datacenters, "namespaces": o.Namespaces, "statuses": o.Statuses} {
+		if len(list) > 0 && !isValidCommaDelimitedList(list) {
+			return cli.NewExitError("You supplied an argument for '"+name+"' but it was not a valid comma-delimited list.", 1)
+		}
+	}
+	if o.Concurrency < 1 || o.Rate < 0 {
+		return cli.NewExitError("--concurrency must be at least 1, and --rate cannot be negative.", 1)
+	}
+
+	stacks, e := NewClient(cfg).ListStacks(ctx, o.Datacenters, o.Namespaces, o.Statuses, o.Unit)
+	if e != nil {
+		PrintTerminalError(e)
+		return cli.NewExitError("Unable to select the stacks to "+verb+".", 1)
+	}
+	if len(stacks) == 0 {
+		RenderMessage("===>> ", "No stacks matched; there is nothing to "+verb+".")
+		return nil
+	}
+	if !isStructuredOutput() {
+		fmt.Println("===>> " + strconv.Itoa(len(stacks)) + " stacks selected to " + verb + ":")
+		PrintListStacks(stacks)
+		fmt.Println("")
+	}
+
+	ce := Confirm(verb+" "+strconv.Itoa(len(stacks))+" stacks", assumeYes, func() ([][]string, error) {
+		return [][]string{
+			{"Stacks", strconv.Itoa(len(stacks))},
+			{"Concurrency", strconv.Itoa(o.Concurrency)},
+		}, nil
+	})
+	if ce != nil {
+		return confirmationExit(ce, "the stacks")
+	}
+
+	concurrency := o.Concurrency
+	if globalDryRun {
+		concurrency = 1 // so that the printed requests are not interleaved
+	}
+	c := NewClient(cfg)
+	results := RunBulk(ctx, stacks, concurrency, o.Rate, func(ctx context.Context, guid string) error {
+		return op(ctx, c, guid)
+	}, func(r BulkResult) {
+		if !isStructuredOutput() {
+			PrintBulkResult(verb, r)
+		}
+	})
+
+	Render(results, func() { PrintBulkResults(results) })
+	if globalDryRun {
+		return endDryRun()
+	}
+	if failed := countFailed(results); failed > 0 {
+		return cli.NewExitError(strconv.Itoa(failed)+" of "+strconv.Itoa(len(results))+" stacks failed to "+verb+".", 1)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+)
+
+func TestRunBulkBoundsConcurrency(t *testing.T) {
+	stacks := []client.Stack{}
+	for _, g := range []string{"a", "b", "c", "d", "e", "f"} {
+		stacks = append(stacks, client.Stack{Guid: g})
+	}
+	var mu sync.Mutex
+	inFlight, most := 0, 0
+	op := func(ctx context.Context, guid string) error {
+		mu.Lock()
+		inFlight++
+		if inFlight > most {
+			most = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		if guid == "c" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	done := 0
+	results := RunBulk(context.Background(), stacks, 2, 0, op, func(BulkResult) { done++ })
+	if most > 2 {
+		t.Errorf("expected at most 2 stacks in flight, saw %d", most)
+	}
+	if done != 6 || countFailed(results) != 1 || results[2].Guid != "c" || results[2].Succeeded || results[2].Error != "boom" {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestRunBulkLimitsRate(t *testing.T) {
+	stacks := []client.Stack{{Guid: "a"}, {Guid: "b"}, {Guid: "c"}}
+	start := time.Now()
+	RunBulk(context.Background(), stacks, 3, 50, func(context.Context, string) error { return nil }, func(BulkResult) {})
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected 3 stacks at 50/s to take at least 40ms, took %s", elapsed)
+	}
+}
+
+func TestBulkStackActionReportsFailures(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var mu sync.Mutex
+	redeployed := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/deployments" {
+			if r.URL.Query().Get("status") != "failed" || r.URL.Query().Get("unit") != "howdy" {
+				t.Errorf("unexpected selection %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`[{"guid": "aaaaaaaaaaaa", "stack_name": "howdy--1-0-0--a"}, {"guid": "bbbbbbbbbbbb", "stack_name": "howdy--1-0-0--b"}]`))
+			return
+		}
+		mu.Lock()
+		redeployed = append(redeployed, r.URL.Path)
+		mu.Unlock()
+		if strings.Contains(r.URL.Path, "bbbbbbbbbbbb") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	o := BulkOptions{Unit: "howdy", Statuses: "failed", Concurrency: 2}
+	err := bulkStackAction(context.Background(), &Config{Endpoint: server.URL}, o, "redeploy", true, func(ctx context.Context, c *client.Client, guid string) error {
+		return c.Redeploy(ctx, guid)
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 stacks failed") {
+		t.Errorf("expected one failure to be reported, got %v", err)
+	}
+	if len(redeployed) != 2 {
+		t.Errorf("expected both stacks to be redeployed, got %v", redeployed)
+	}
+}
+
+func TestRunBulkDryRunIsNotAFailure(t *testing.T) {
+	stacks := []client.Stack{{Guid: "a"}, {Guid: "b"}}
+	results := RunBulk(context.Background(), stacks, 1, 0, func(context.Context, string) error { return client.ErrDryRun }, func(BulkResult) {})
+	if countFailed(results) != 0 || !results[0].DryRun || !results[1].DryRun {
+		t.Errorf("expected every stack to be reported as a dry run, got %+v", results)
+	}
+}
@@ -0,0 +1,166 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+)
+
+const (
+	CanaryPassed   = "passed"   // the canary stayed healthy for the whole watch
+	CanaryReversed = "reversed" // the canary breached its thresholds and the shift was reversed
+)
+
+// CanaryThresholds say when a canary is unhealthy: when the scheduler
+// reports more than MaxFailed failed instances, or consul more than
+// MaxFailingChecks checks that are not passing. The traffic shift is
+// only reversed after Breaches unhealthy samples in a row.
+type CanaryThresholds struct {
+	MaxFailed        int
+	MaxFailingChecks int
+	Breaches         int
+}
+
+/*
+ * {
+ *   "guid": "b8ff485a0306",
+ *   "verdict": "reversed",
+ *   "reason": "2 consecutive samples breached the thresholds; last: 2 failed instances (max 0)",
+ *   "samples": [
+ *     { "time": "2017-06-01T10:00:00Z", "status": "ready", "failed": 0, "running": 3, "failing_checks": 0, "breached": false },
+ *     { "time": "2017-06-01T10:00:30Z", "status": "ready", "failed": 1, "running": 2, "failing_checks": 0, "breached": true,
+ *       "note": "1 failed instances (max 0)" },
+ *     { "time": "2017-06-01T10:01:00Z", "status": "ready", "failed": 2, "running": 1, "failing_checks": 0, "breached": true,
+ *       "note": "2 failed instances (max 0)" }
+ *   ]
+ * }
+ */
+type CanaryReport struct {
+	Guid    string         `json:"guid"`
+	Verdict string         `json:"verdict"`
+	Reason  string         `json:"reason"`
+	Samples []CanarySample `json:"samples"`
+}
+
+type CanarySample struct {
+	Time          string `json:"time"`
+	Status        string `json:"status"`
+	Failed        int    `json:"failed"`
+	Running       int    `json:"running"`
+	FailingChecks int    `json:"failing_checks"`
+	Breached      bool   `json:"breached"`
+	Note          string `json:"note,omitempty"`
+}
+
+// WatchCanary samples the runtime of the stack receiving an in-progress
+// traffic shift every interval for duration, passing each sample to emit.
+// Once the thresholds are breached often enough in a row the shift is
+// reversed. The report is returned either way; the error is only set
+// when nelson could not be asked for a sample or to reverse.
+func WatchCanary(ctx context.Context, c *client.Client, guid string, thresholds CanaryThresholds, interval time.Duration, duration time.Duration, emit func(CanarySample)) (CanaryReport, error) {
+	report := CanaryReport{Guid: guid, Samples: []CanarySample{}}
+	deadline := time.Now().Add(duration)
+	breaches := 0
+	for {
+		rt, err := c.GetStackRuntime(ctx, guid)
+		if err != nil {
+			return report, err
+		}
+		sample := sampleCanary(rt, thresholds)
+		report.Samples = append(report.Samples, sample)
+		emit(sample)
+
+		if sample.Breached {
+			breaches++
+		} else {
+			breaches = 0
+		}
+		if breaches >= thresholds.Breaches || canaryFailedStatuses[sample.Status] {
+			report.Verdict = CanaryReversed
+			report.Reason = strconv.Itoa(breaches) + " consecutive samples breached the thresholds; last: " + sample.Note
+			return report, c.ReverseTrafficShift(ctx, guid)
+		}
+		if !time.Now().Add(interval).Before(deadline) {
+			report.Verdict = CanaryPassed
+			report.Reason = "stayed within the thresholds for " + duration.String()
+			return report, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// statuses that fail a canary outright, without waiting for more samples.
+var canaryFailedStatuses = map[string]bool{
+	"failed":     true,
+	"terminated": true,
+	"garbage":    true,
+}
+
+func sampleCanary(rt client.StackRuntime, thresholds CanaryThresholds) CanarySample {
+	s := CanarySample{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Status:  rt.CurrentStatus,
+		Failed:  rt.Scheduler.Failed,
+		Running: rt.Scheduler.Running,
+	}
+	for _, h := range rt.ConsulHealth {
+		if h.Status != "passing" {
+			s.FailingChecks++
+		}
+	}
+
+	notes := []string{}
+	if canaryFailedStatuses[s.Status] {
+		notes = append(notes, "stack is "+s.Status)
+	}
+	if s.Failed > thresholds.MaxFailed {
+		notes = append(notes, fmt.Sprintf("%d failed instances (max %d)", s.Failed, thresholds.MaxFailed))
+	}
+	if s.FailingChecks > thresholds.MaxFailingChecks {
+		notes = append(notes, fmt.Sprintf("%d failing health checks (max %d)", s.FailingChecks, thresholds.MaxFailingChecks))
+	}
+	s.Breached = len(notes) > 0
+	for i, n := range notes {
+		if i > 0 {
+			s.Note += "; "
+		}
+		s.Note += n
+	}
+	return s
+}
+
+func PrintCanarySample(s CanarySample) {
+	verdict := "ok"
+	if s.Breached {
+		verdict = "BREACHED: " + s.Note
+	}
+	fmt.Printf("%s  %-10s failed=%d running=%d failing_checks=%d  %s\n", s.Time, s.Status, s.Failed, s.Running, s.FailingChecks, verdict)
+}
+
+func PrintCanaryReport(r CanaryReport) {
+	fmt.Println("===>> Canary " + r.Guid + " " + r.Verdict + ": " + r.Reason)
+}
@@ -0,0 +1,103 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+)
+
+// serves the given runtimes in turn, repeating the last one, and counts
+// requests to reverse the traffic shift.
+func canaryServer(runtimes []string, reversed *int) *httptest.Server {
+	polls := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/trafficshift/reverse") {
+			*reversed++
+			return
+		}
+		i := polls
+		if i >= len(runtimes) {
+			i = len(runtimes) - 1
+		}
+		polls++
+		w.Write([]byte(runtimes[i]))
+	}))
+}
+
+const healthyRuntime = `{"current_status": "ready", "scheduler": {"running": 3}, "consul_health": [{"status": "passing"}]}`
+
+func TestWatchCanaryReversesAfterConsecutiveBreaches(t *testing.T) {
+	reversed := 0
+	server := canaryServer([]string{
+		healthyRuntime,
+		`{"current_status": "ready", "scheduler": {"failed": 1, "running": 2}}`,
+		healthyRuntime, // a blip does not count
+		`{"current_status": "ready", "scheduler": {"failed": 2, "running": 1}}`,
+		`{"current_status": "ready", "scheduler": {"running": 3}, "consul_health": [{"status": "critical"}]}`,
+	}, &reversed)
+	defer server.Close()
+
+	thresholds := CanaryThresholds{Breaches: 2}
+	report, err := WatchCanary(context.Background(), client.New(server.URL, client.Session{}), "abc", thresholds, time.Millisecond, time.Minute, func(CanarySample) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verdict != CanaryReversed || reversed != 1 || len(report.Samples) != 5 {
+		t.Errorf("expected a reversal after 5 samples, got %+v with %d reversals", report, reversed)
+	}
+	if last := report.Samples[4]; !last.Breached || last.FailingChecks != 1 || !strings.Contains(last.Note, "health checks") {
+		t.Errorf("unexpected last sample %+v", last)
+	}
+}
+
+func TestWatchCanaryPassesWithinThresholds(t *testing.T) {
+	reversed := 0
+	server := canaryServer([]string{
+		`{"current_status": "ready", "scheduler": {"failed": 1, "running": 2}}`,
+	}, &reversed)
+	defer server.Close()
+
+	thresholds := CanaryThresholds{MaxFailed: 1, Breaches: 1}
+	report, err := WatchCanary(context.Background(), client.New(server.URL, client.Session{}), "abc", thresholds, time.Millisecond, 20*time.Millisecond, func(CanarySample) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verdict != CanaryPassed || reversed != 0 || len(report.Samples) == 0 {
+		t.Errorf("expected the canary to pass, got %+v with %d reversals", report, reversed)
+	}
+}
+
+func TestWatchCanaryReversesFailedStackAtOnce(t *testing.T) {
+	reversed := 0
+	server := canaryServer([]string{`{"current_status": "failed"}`}, &reversed)
+	defer server.Close()
+
+	report, err := WatchCanary(context.Background(), client.New(server.URL, client.Session{}), "abc", CanaryThresholds{Breaches: 3}, time.Millisecond, time.Minute, func(CanarySample) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verdict != CanaryReversed || reversed != 1 || len(report.Samples) != 1 {
+		t.Errorf("expected an immediate reversal, got %+v", report)
+	}
+}
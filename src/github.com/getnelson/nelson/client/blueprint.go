@@ -0,0 +1,103 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2018 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+)
+
+/////////////////// PROOFING BLUEPRINTS ///////////////////
+
+/*
+ * {
+ *   "content": "CAgICAgIHBsYW5zOg0KICAgICAgICAgIC0gZGVmYXVsdA=="
+ * }
+ */
+type ProofBlueprintWire struct {
+	Content string `json:"content"`
+}
+
+// ProofBlueprint returns the example output Nelson rendered for the
+// template, already decoded from base64.
+func (c *Client) ProofBlueprint(ctx context.Context, req ProofBlueprintWire) (string, error) {
+	r, body, err := c.do(ctx, "POST", "/v1/blueprints/proof", req)
+	if err != nil {
+		return "", err
+	}
+	if r.StatusCode/100 != 2 {
+		return "", newAPIError(r, body, nil)
+	}
+	var result ProofBlueprintWire
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", newAPIError(r, body, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(result.Content)
+	if err != nil {
+		return "", newAPIError(r, body, err)
+	}
+	return string(data[:]), nil
+}
+
+/////////////////// CREATING BLUEPRINTS ///////////////////
+
+/*
+ * {
+ *    "name": "use-nvidia-1080ti",
+ *    "description": "only scheudle on nodes with nvida 1080ti hardware"
+ *    "sha256": "1e34a423ebe1fafeda8277386ede3263b01357e490b124b69bc0bfb493e64140"
+ *    "template": "<base64 encoded template>"
+ * }
+ */
+type BlueprintResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Revision    string `json:"revision"`
+	Sha256      string `json:"sha256"`
+	Template    string `json:"template"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+type CreateBlueprintRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Sha256      string `json:"sha256"`
+	Template    string `json:"template"`
+}
+
+func (c *Client) CreateBlueprint(ctx context.Context, req CreateBlueprintRequest) (BlueprintResponse, error) {
+	var result BlueprintResponse
+	err := c.doJSON(ctx, "POST", "/v1/blueprints", req, &result)
+	return result, err
+}
+
+/////////////////// LISTING BLUEPRINTS ///////////////////
+
+func (c *Client) ListBlueprints(ctx context.Context) ([]BlueprintResponse, error) {
+	var list []BlueprintResponse
+	err := c.doJSON(ctx, "GET", "/v1/blueprints", nil, &list)
+	return list, err
+}
+
+/////////////////// INSPECTING BLUEPRINTS ///////////////////
+
+func (c *Client) InspectBlueprint(ctx context.Context, namedRevision string) (BlueprintResponse, error) {
+	var result BlueprintResponse
+	err := c.doJSON(ctx, "GET", "/v1/blueprints/"+namedRevision, nil, &result)
+	return result, err
+}
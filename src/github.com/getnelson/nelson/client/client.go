@@ -0,0 +1,334 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+
+// Package client is a Go client for the Nelson deployment system API.
+// It is what the nelson CLI itself uses to talk to Nelson, and can be
+// imported by other tools that need to do the same.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/moul/http2curl"
+)
+
+const (
+	DefaultTimeout   = 60 * time.Second
+	DefaultUserAgent = "NelsonClient"
+	sessionCookie    = "nelson.session"
+
+	AuthCookie = "cookie"
+	AuthBearer = "bearer"
+)
+
+// Client holds everything needed to talk to one Nelson endpoint on
+// behalf of one session. All methods are safe for concurrent use.
+type Client struct {
+	// Endpoint is the base url of the Nelson server, including the scheme,
+	// e.g. https://nelson.yourcompany.com
+	Endpoint string
+	Session  Session
+
+	HTTPClient *http.Client
+	UserAgent  string
+
+	// Auth is how the session is presented: AuthCookie (the default)
+	// sends the nelson.session cookie, AuthBearer an Authorization header.
+	Auth string
+
+	// Debug logs every request and response; Curl logs the curl command
+	// analog of every request. Session cookies are redacted in both.
+	Debug  bool
+	Curl   bool
+	Logger *log.Logger
+
+	// Requests failing with one of RetryStatuses are retried up
+	// to Retries times, waiting RetryDelay between attempts.
+	Retries       int
+	RetryDelay    time.Duration
+	RetryStatuses []int
+
+	// DryRun stops every request that could change something at the
+	// transport: it is written to DryRunOutput (stdout when nil) instead of
+	// being sent, and the call returns ErrDryRun. Reads, including the
+	// POSTs that only validate their body, still go to the server.
+	DryRun       bool
+	DryRunOutput io.Writer
+
+	// Renew, when set, is called when a request fails with a 401; the
+	// request is retried once with the session it returns. Concurrent
+	// failures with the same session share a single renewal.
+	Renew func(ctx context.Context) (Session, error)
+
+	mu sync.Mutex // guards Session during renewal
+}
+
+// New returns a Client for the given endpoint and session with the
+// same defaults used by the nelson CLI.
+func New(endpoint string, session Session) *Client {
+	return &Client{
+		Endpoint:      endpoint,
+		Session:       session,
+		HTTPClient:    &http.Client{Timeout: DefaultTimeout},
+		UserAgent:     DefaultUserAgent,
+		Logger:        log.New(os.Stderr, "[nelson]", log.LstdFlags),
+		Retries:       3,
+		RetryDelay:    1 * time.Second,
+		RetryStatuses: []int{http.StatusBadGateway, http.StatusInternalServerError},
+	}
+}
+
+/////////////////////////////// TRANSPORT ////////////////////////////////
+
+// readOnlyPosts are the endpoints that are POSTed to only because they
+// take a body to check; they change nothing in nelson.
+var readOnlyPosts = map[string]bool{
+	"/v1/lint":              true,
+	"/v1/validate-template": true,
+	"/v1/blueprints/proof":  true,
+}
+
+func mutates(method string, path string) bool {
+	return method != "GET" && !(method == "POST" && readOnlyPosts[path])
+}
+
+// do sends a request to the given path on the Nelson endpoint, json encoding
+// body when it is non-nil, and returns the response along with its body.
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}) (*http.Response, []byte, error) {
+	var payload []byte
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		payload = b
+	}
+
+	renewed := false
+	for attempt := 0; ; attempt++ {
+		session := c.session()
+		req, err := c.newRequest(ctx, method, path, payload, session)
+		if err != nil {
+			return nil, nil, err
+		}
+		if c.DryRun && mutates(method, path) {
+			c.writeDryRun(req, payload)
+			return nil, nil, ErrDryRun
+		}
+
+		r, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.logResponse(r)
+		bytes, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if r.StatusCode == http.StatusUnauthorized && c.Renew != nil && !renewed {
+			renewed = true
+			if c.renewSession(ctx, session) == nil {
+				attempt--
+				continue
+			}
+		}
+		if attempt >= c.Retries || !c.isRetryable(r.StatusCode) {
+			return r, bytes, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(c.RetryDelay):
+		}
+	}
+}
+
+// doJSON is do for the common case of a request whose successful
+// response is json to be decoded into out, which may be nil.
+func (c *Client) doJSON(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	r, bytes, err := c.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode/100 != 2 {
+		return newAPIError(r, bytes, nil)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(bytes, out); err != nil {
+		return newAPIError(r, bytes, err)
+	}
+	return nil
+}
+
+func (c *Client) session() Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Session
+}
+
+// replaces the session that a request was rejected with, unless another
+// request has already done so.
+func (c *Client) renewSession(ctx context.Context, rejected Session) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Session.SessionToken != rejected.SessionToken {
+		return nil
+	}
+	s, err := c.Renew(ctx)
+	if err != nil {
+		c.Logger.Println("Unable to renew the session:", err)
+		return err
+	}
+	c.Session = s
+	return nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, payload []byte, session Session) (*http.Request, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, c.Endpoint+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-type", "application/json")
+	req.Header.Set("User-Agent", c.UserAgent)
+	if len(session.SessionToken) > 0 {
+		if c.Auth == AuthBearer {
+			req.Header.Set("Authorization", "Bearer "+session.SessionToken)
+		} else {
+			req.AddCookie(c.authCookie(session))
+		}
+	}
+	c.logRequest(req)
+	return req, nil
+}
+
+// the session cookie, scoped to the host of the endpoint and only
+// marked secure when the endpoint is https.
+func (c *Client) authCookie(session Session) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:  sessionCookie,
+		Value: session.SessionToken,
+		Path:  "/",
+	}
+	if u, err := url.Parse(c.Endpoint); err == nil {
+		cookie.Domain = u.Hostname()
+		cookie.Secure = u.Scheme == "https"
+	}
+	if session.ExpiresAt > 0 {
+		cookie.Expires = time.Unix(0, session.ExpiresAt*int64(time.Millisecond))
+	}
+	return cookie
+}
+
+func (c *Client) isRetryable(status int) bool {
+	for _, s := range c.RetryStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidCommaDelimitedList(str string) bool {
+	match, _ := regexp.MatchString(`^([a-z0-9/\\-]+,?)+$`, str)
+	return match
+}
+
+//////////////////////////////// LOGGING /////////////////////////////////
+
+var sanitizer = regexp.MustCompile(sessionCookie + "=[^;\"'\\s]*")
+var bearerSanitizer = regexp.MustCompile(`Bearer [^;"'\s]*`)
+var tokenSanitizer = regexp.MustCompile(`"access_token":\s*"[^"]*"`)
+
+func redact(s string) string {
+	s = sanitizer.ReplaceAllString(s, sessionCookie+"=<redacted>")
+	s = bearerSanitizer.ReplaceAllString(s, "Bearer <redacted>")
+	return tokenSanitizer.ReplaceAllString(s, `"access_token": "<redacted>"`)
+}
+
+// writes the request as it would have been sent, with the session
+// redacted and the body pretty printed.
+func (c *Client) writeDryRun(req *http.Request, payload []byte) {
+	w := c.DryRunOutput
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintf(w, "%s %s\n", req.Method, req.URL)
+
+	keys := []string{}
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			fmt.Fprintln(w, redact(k+": "+v))
+		}
+	}
+
+	if len(payload) > 0 {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, payload, "", "  ") == nil {
+			payload = pretty.Bytes()
+		}
+		fmt.Fprintf(w, "\n%s\n", redact(string(payload)))
+	}
+}
+
+func (c *Client) logRequest(req *http.Request) {
+	if c.Curl {
+		if cmd, err := http2curl.GetCurlCommand(req); err == nil {
+			c.Logger.Println("CURL command line:", redact(cmd.String()))
+		}
+	}
+	if c.Debug {
+		if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+			c.Logger.Printf("HTTP Request: %s", redact(string(dump)))
+		}
+	}
+}
+
+func (c *Client) logResponse(r *http.Response) {
+	if c.Debug {
+		if dump, err := httputil.DumpResponse(r, true); err == nil {
+			c.Logger.Printf("HTTP Response: %s", redact(string(dump)))
+		}
+	}
+}
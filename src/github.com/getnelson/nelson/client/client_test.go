@@ -0,0 +1,283 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientSendsSessionCookie(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookie)
+		if err != nil || cookie.Value != "abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"user": {"login": "octocat"}}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, Session{SessionToken: "abc"})
+	resp, err := c.WhoAmI(context.Background())
+	if err != nil || resp.User.Login != "octocat" {
+		t.Error("Expected the session cookie to be accepted, but got", resp, err)
+	}
+}
+
+func TestClientRetriesBadGateway(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, Session{})
+	c.RetryDelay = time.Millisecond
+	if _, err := c.ListDatacenters(context.Background()); err != nil {
+		t.Error("Expected the request to succeed after retrying, but got", err)
+	}
+	if attempts != 3 {
+		t.Error(3, attempts)
+	}
+}
+
+func TestClientReturnsAPIErrorForNon2xx(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "no such stack"}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, Session{})
+	_, err := c.InspectStack(context.Background(), "e4184c271bb9")
+	e, ok := err.(*APIError)
+	if !ok {
+		t.Fatal("Expected an APIError for a 404 response, but got", err)
+	}
+	if e.StatusCode != 404 || e.Method != "GET" || e.URL != server.URL+"/v1/deployments/e4184c271bb9" || e.Message != "no such stack" {
+		t.Error("Unexpected APIError", e)
+	}
+	if !IsStatus(err, http.StatusNotFound) {
+		t.Error("Expected IsStatus to match 404")
+	}
+}
+
+func TestClientReturnsAPIErrorForMalformedBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html>not json</html>`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, Session{})
+	_, err := c.ListStacks(context.Background(), "", "dev", "", "")
+	e, ok := err.(*APIError)
+	if !ok || e.Err == nil || string(e.Body) != "<html>not json</html>" {
+		t.Error("Expected an APIError carrying the decode failure and raw body, but got", err)
+	}
+}
+
+func TestRedactSessionCookie(t *testing.T) {
+	out := redact("curl -X GET -H 'Cookie: nelson.session=abc123' 'https://nelson/v1/units'")
+	if out != "curl -X GET -H 'Cookie: nelson.session=<redacted>' 'https://nelson/v1/units'" {
+		t.Error("Expected the session to be redacted, but got", out)
+	}
+}
+
+func TestRedactAccessToken(t *testing.T) {
+	out := redact(`{"access_token": "ghp_abc"}`)
+	if out != `{"access_token": "<redacted>"}` {
+		t.Error("Expected the token to be redacted, but got", out)
+	}
+}
+
+func TestDryRunStopsMutations(t *testing.T) {
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	c := New(server.URL, Session{SessionToken: "abc"})
+	c.DryRun = true
+	c.DryRunOutput = &out
+
+	if _, err := c.ListDatacenters(context.Background()); err != nil {
+		t.Fatalf("Expected reads to be sent, but got %v", err)
+	}
+	err := c.CommitUnit(context.Background(), CommitRequest{UnitName: "howdy", Version: "1.2.3", Target: "qa"})
+	if err != ErrDryRun {
+		t.Fatalf("Expected ErrDryRun, but got %v", err)
+	}
+	if len(methods) != 1 || methods[0] != "GET" {
+		t.Errorf("Expected only the GET to reach the server, but got %v", methods)
+	}
+
+	printed := out.String()
+	for _, want := range []string{"POST " + server.URL + "/v1/units/commit\n", "Cookie: nelson.session=<redacted>", `"unit": "howdy"`} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("Expected the dry run to print %q, but got:\n%s", want, printed)
+		}
+	}
+}
+
+func TestDryRunSendsValidation(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"content": "b2s="}`))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	c := New(server.URL, Session{SessionToken: "abc"})
+	c.DryRun = true
+	c.DryRunOutput = &out
+
+	if _, errs := c.LintManifest(context.Background(), LintManifestRequest{Units: []ManifestUnit{{Kind: "howdy", Name: "howdy"}}, Manifest: "bWFuaWZlc3Q="}); errs != nil {
+		t.Errorf("Expected the manifest to be linted, but got %v", errs)
+	}
+	if _, errs := c.LintTemplate(context.Background(), LintTemplateRequest{Unit: "howdy", Resources: []string{}, Template: "dGVtcGxhdGU="}); errs != nil {
+		t.Errorf("Expected the template to be validated, but got %v", errs)
+	}
+	if _, err := c.ProofBlueprint(context.Background(), ProofBlueprintWire{Content: "dGVtcGxhdGU="}); err != nil {
+		t.Errorf("Expected the blueprint to be proofed, but got %v", err)
+	}
+	want := "POST /v1/lint,POST /v1/validate-template,POST /v1/blueprints/proof"
+	if strings.Join(paths, ",") != want {
+		t.Errorf("Expected %s to reach the server, but got %v", want, paths)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected nothing to be printed in place of a request, but got:\n%s", out.String())
+	}
+}
+
+func TestRenewsSessionOnUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookie)
+		if err != nil || cookie.Value != "fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"user": {"login": "octocat"}}`))
+	}))
+	defer server.Close()
+
+	renewals := 0
+	c := New(server.URL, Session{SessionToken: "stale"})
+	c.Renew = func(ctx context.Context) (Session, error) {
+		renewals++
+		return Session{SessionToken: "fresh"}, nil
+	}
+
+	if _, err := c.WhoAmI(context.Background()); err != nil {
+		t.Fatalf("Expected the request to succeed after renewal, but got %v", err)
+	}
+	if renewals != 1 || c.Session.SessionToken != "fresh" {
+		t.Errorf("Expected a single renewal to replace the session, but got %d renewals and %q", renewals, c.Session.SessionToken)
+	}
+
+	// a renewed session that is still rejected is not renewed again
+	c.Renew = func(ctx context.Context) (Session, error) {
+		renewals++
+		return Session{SessionToken: "also-stale"}, nil
+	}
+	c.Session = Session{SessionToken: "stale"}
+	if _, err := c.WhoAmI(context.Background()); !IsStatus(err, http.StatusUnauthorized) {
+		t.Errorf("Expected a 401 once renewal did not help, but got %v", err)
+	}
+	if renewals != 2 {
+		t.Errorf("Expected one more renewal, but got %d in total", renewals)
+	}
+}
+
+// accepts the session "abc" from either a cookie or a bearer header,
+// recording which one arrived.
+func authTestHandler(seen *string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(sessionCookie); err == nil && cookie.Value == "abc" {
+			*seen = AuthCookie
+		} else if r.Header.Get("Authorization") == "Bearer abc" {
+			*seen = AuthBearer
+		} else {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"user": {"login": "octocat"}}`))
+	}
+}
+
+func TestClientAuthModes(t *testing.T) {
+	var seen string
+	servers := map[string]*httptest.Server{
+		"http":  httptest.NewServer(authTestHandler(&seen)),
+		"https": httptest.NewTLSServer(authTestHandler(&seen)),
+	}
+	for scheme, server := range servers {
+		defer server.Close()
+		for _, auth := range []string{"", AuthCookie, AuthBearer} {
+			seen = ""
+			c := New(server.URL, Session{SessionToken: "abc"})
+			c.HTTPClient = server.Client()
+			c.Auth = auth
+
+			if _, err := c.WhoAmI(context.Background()); err != nil {
+				t.Errorf("Expected %s auth %q to be accepted, but got %v", scheme, auth, err)
+			}
+			want := auth
+			if want == "" {
+				want = AuthCookie
+			}
+			if seen != want {
+				t.Errorf("Expected %s auth %q to arrive as %s, but got %q", scheme, auth, want, seen)
+			}
+		}
+	}
+}
+
+func TestAuthCookieFollowsEndpoint(t *testing.T) {
+	session := Session{SessionToken: "abc", ExpiresAt: 1500000000000}
+
+	cookie := New("https://nelson.example.org:8443", session).authCookie(session)
+	if cookie.Domain != "nelson.example.org" || !cookie.Secure || cookie.Expires.Unix() != 1500000000 {
+		t.Errorf("Expected a secure cookie for nelson.example.org expiring with the session, but got %+v", cookie)
+	}
+
+	cookie = New("http://127.0.0.1:9000", session).authCookie(session)
+	if cookie.Domain != "127.0.0.1" || cookie.Secure {
+		t.Errorf("Expected an insecure cookie for 127.0.0.1, but got %+v", cookie)
+	}
+}
+
+func TestRedactBearerToken(t *testing.T) {
+	out := redact("curl -H 'Authorization: Bearer abc123' 'https://nelson/v1/units'")
+	if out != "curl -H 'Authorization: Bearer <redacted>' 'https://nelson/v1/units'" {
+		t.Error("Expected the bearer token to be redacted, but got", out)
+	}
+}
@@ -0,0 +1,36 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"context"
+)
+
+type Datacenter struct {
+	Name       string      `json:"name"`
+	Namespaces []Namespace `json:"namespaces"`
+}
+type Namespace struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (c *Client) ListDatacenters(ctx context.Context) ([]Datacenter, error) {
+	var list []Datacenter
+	err := c.doJSON(ctx, "GET", "/v1/datacenters", nil, &list)
+	return list, err
+}
@@ -0,0 +1,96 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrDryRun is returned in place of a response for every request that
+// a Client in DryRun mode did not send.
+var ErrDryRun = errors.New("dry run: the request was not sent")
+
+// APIError is returned by every Client method whenever Nelson answers
+// with a non-2xx status, or with a body that cannot be decoded. Errors
+// that happen before a response arrives (dns, tls, timeouts) are
+// returned as-is.
+type APIError struct {
+	StatusCode int
+	Method     string
+	URL        string
+	// Message is the explanation given by the server, taken from the
+	// "message" field of a json body, or the body itself otherwise.
+	Message string
+	Body    []byte
+	// Err is the decoding error for a 2xx response that could not be
+	// understood, and is nil for non-2xx responses.
+	Err error
+}
+
+/*
+ * { "message": "stack e4184c271bb9 is not in a state that can be reversed" }
+ */
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	status := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Err != nil {
+		return fmt.Sprintf("Unable to decode the %s response to %s %s: %s", status, e.Method, e.URL, e.Err.Error())
+	}
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("Nelson responded to %s %s with %s", e.Method, e.URL, status)
+	}
+	return fmt.Sprintf("Nelson responded to %s %s with %s: %s", e.Method, e.URL, status, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// IsStatus reports whether err is an APIError with the given status code.
+func IsStatus(err error, status int) bool {
+	e, ok := err.(*APIError)
+	return ok && e.StatusCode == status
+}
+
+func newAPIError(r *http.Response, body []byte, err error) *APIError {
+	e := &APIError{
+		StatusCode: r.StatusCode,
+		Method:     r.Request.Method,
+		URL:        r.Request.URL.String(),
+		Body:       body,
+		Err:        err,
+	}
+	if err == nil {
+		e.Message = serverMessage(body)
+	}
+	return e
+}
+
+func serverMessage(body []byte) string {
+	var er errorResponse
+	if err := json.Unmarshal(body, &er); err == nil && len(er.Message) > 0 {
+		return er.Message
+	}
+	return strings.TrimSpace(string(body))
+}
@@ -0,0 +1,122 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"context"
+)
+
+/*
+ * {
+ *   "name": "howdy-lb",
+ *   "major_version": 1,
+ *   "datacenter": "us-east-1",
+ *   "namespace": "dev"
+ * }
+ */
+type LoadbalancerCreate struct {
+	Name         string `json:"name"`
+	MajorVersion int    `json:"major_version"`
+	Datacenter   string `json:"datacenter"`
+	Namespace    string `json:"namespace"`
+}
+
+/*
+ * {
+ *   "name": "howdy-lb--1--974u8r6v",
+ *   "routes": [
+ *     ...
+ *   ],
+ *   "guid": "b74b8209468b",
+ *   "deploy_time": 1481065235649,
+ *   "datacenter": "us-east-1",
+ *   "namespace": "dev"
+ * }
+ */
+type Loadbalancer struct {
+	Name         string              `json:"name"`
+	Routes       []LoadbalancerRoute `json:"routes"`
+	Guid         string              `json:"guid"`
+	DeployTime   int                 `json:"deploy_time"`
+	Datacenter   string              `json:"datacenter"`
+	Namespace    string              `json:"namespace"`
+	Address      string              `json:"address"`
+	Version      int                 `json:"major_version"`
+	Dependencies DependencyArray     `json:"dependencies"`
+}
+
+/*
+ * {
+ *   "backend_port_reference": "default",
+ *   "backend_major_version": 1,
+ *   "backend_name": "howdy-http",
+ *   "lb_port": 8444
+ * }
+ */
+type LoadbalancerRoute struct {
+	BackendPortReference string `json:"backend_port_reference"`
+	BackendName          string `json:"backend_name"`
+	LBPort               int    `json:"lb_port"`
+}
+
+type DependencyArray struct {
+	Outbound []LoadbalancerDependencyOutbound `json:"outbound"`
+}
+
+type LoadbalancerDependencyOutbound struct {
+	DeployTime int    `json:"deployed_at"`
+	Type       string `json:"type"`
+	StackName  string `json:"stack_name"`
+	Guid       string `json:"guid"`
+}
+
+//////////////////////// LIST ////////////////////////
+
+func (c *Client) ListLoadbalancers(ctx context.Context, delimitedDcs string, delimitedNamespaces string) ([]Loadbalancer, error) {
+	uri := "/v1/loadbalancers?"
+	// set the datacenters if specified
+	if isValidCommaDelimitedList(delimitedDcs) {
+		uri = uri + "dc=" + delimitedDcs + "&"
+	}
+	if isValidCommaDelimitedList(delimitedNamespaces) {
+		uri = uri + "ns=" + delimitedNamespaces
+	} else {
+		uri = uri + "ns=dev,qa,prod"
+	}
+
+	var list []Loadbalancer
+	err := c.doJSON(ctx, "GET", uri, nil, &list)
+	return list, err
+}
+
+func (c *Client) InspectLoadBalancer(ctx context.Context, guid string) (Loadbalancer, error) {
+	var lb Loadbalancer
+	err := c.doJSON(ctx, "GET", "/v1/loadbalancers/"+guid, nil, &lb)
+	return lb, err
+}
+
+//////////////////////// REMOVE ////////////////////////
+
+func (c *Client) RemoveLoadBalancer(ctx context.Context, guid string) error {
+	return c.doJSON(ctx, "DELETE", "/v1/loadbalancers/"+guid, nil, nil)
+}
+
+//////////////////////// CREATE ////////////////////////
+
+func (c *Client) CreateLoadBalancer(ctx context.Context, req LoadbalancerCreate) error {
+	return c.doJSON(ctx, "POST", "/v1/loadbalancers", req, nil)
+}
@@ -14,13 +14,11 @@
 //:   limitations under the License.
 //:
 //: ----------------------------------------------------------------------------
-package main
+package client
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
-	"github.com/parnurzeal/gorequest"
-	"strconv"
 )
 
 /*
@@ -41,28 +39,27 @@ type LintTemplateFailure struct {
 	Details string `json:"details"`
 }
 
-func LintTemplate(req LintTemplateRequest, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-	r, body, errs := AugmentRequest(http.Post(cfg.Endpoint+"/v1/validate-template"), cfg).Send(req).EndBytes()
-
-	if errs != nil {
-		return "", errs
+// LintTemplate asks Nelson to render the template the way it would be
+// rendered in the unit's container. When rendering fails the returned
+// string holds the rendering output, alongside the error.
+func (c *Client) LintTemplate(ctx context.Context, req LintTemplateRequest) (string, error) {
+	r, body, err := c.do(ctx, "POST", "/v1/validate-template", req)
+	if err != nil {
+		return "", err
 	}
 
 	if r.StatusCode/100 == 2 {
-		return "Template rendered successfully.\nRendered output discarded for security reasons.", errs
+		return "", nil
 	} else if r.StatusCode == 400 || r.StatusCode == 504 {
 		var fail LintTemplateFailure
 		if err := json.Unmarshal(body, &fail); err != nil {
-			resp := string(body[:])
-			errs = append(errs, errors.New("Unexpected response from Nelson server: JSON error"))
-			return resp, errs
+			return string(body[:]), newAPIError(r, body, err)
 		}
-		errs = append(errs, errors.New(fail.Message))
-		return fail.Details, errs
+		e := newAPIError(r, body, nil)
+		e.Message = fail.Message
+		return fail.Details, e
 	} else {
-		resp := string(body[:])
-		errs = append(errs, errors.New("Unexpected response from Nelson server: HTTP status "+strconv.Itoa(r.StatusCode)))
-		return resp, errs
+		return string(body[:]), newAPIError(r, body, nil)
 	}
 }
 
@@ -82,22 +79,21 @@ type ManifestUnit struct {
 	Name string `json:"name"`
 }
 
-func LintManifest(req LintManifestRequest, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-	r, body, errs := AugmentRequest(http.Post(cfg.Endpoint+"/v1/lint"), cfg).Send(req).EndBytes()
-
-	if errs != nil {
-		return "", errs
+// LintManifest validates the manifest against Nelson. When validation
+// fails the returned string holds Nelson's explanation, alongside the error.
+func (c *Client) LintManifest(ctx context.Context, req LintManifestRequest) (string, error) {
+	r, body, err := c.do(ctx, "POST", "/v1/lint", req)
+	if err != nil {
+		return "", err
 	}
 
 	if r.StatusCode/100 == 2 {
-		return "Nelson manifest validated with no errors.\n", errs
+		return "", nil
 	} else if r.StatusCode == 400 || r.StatusCode == 504 {
-		resp := string(body[:])
-		errs = append(errs, errors.New(""))
-		return resp, errs
+		e := newAPIError(r, body, nil)
+		e.Message = "Nelson manifest validation failed"
+		return string(body[:]), e
 	} else {
-		resp := string(body[:])
-		errs = append(errs, errors.New("Unexpected response from Nelson server: HTTP status "+strconv.Itoa(r.StatusCode)))
-		return resp, errs
+		return string(body[:]), newAPIError(r, body, nil)
 	}
 }
@@ -0,0 +1,46 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"context"
+)
+
+type CreateSessionRequest struct {
+	AccessToken string `json:"access_token"`
+}
+
+// { "session_token": "xxx", "expires_at": 12345 }
+type Session struct {
+	SessionToken string `json:"session_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// CreateSession exchanges a github personal access token for a Nelson
+// session. The client does not need to hold a session to call this.
+func (c *Client) CreateSession(ctx context.Context, githubToken string) (Session, error) {
+	var result Session
+	err := c.doJSON(ctx, "POST", "/auth/github", CreateSessionRequest{AccessToken: githubToken}, &result)
+	return result, err
+}
+
+// DeleteSession invalidates the session the client holds, so that it
+// can no longer be used even before it expires. Not every Nelson serves
+// DELETE /session; those that do not answer 404 or 405.
+func (c *Client) DeleteSession(ctx context.Context) error {
+	return c.doJSON(ctx, "DELETE", "/session", nil, nil)
+}
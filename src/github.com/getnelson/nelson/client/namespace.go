@@ -14,31 +14,16 @@
 //:   limitations under the License.
 //:
 //: ----------------------------------------------------------------------------
-package main
+package client
 
 import (
-	"errors"
-	"github.com/parnurzeal/gorequest"
+	"context"
 )
 
 type NamespaceRequest struct {
 	Namespace string `json:"namespace"`
 }
 
-func CreateNamespace(req NamespaceRequest, dc string, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-
-	r, body, errs := AugmentRequest(
-		http.Post(cfg.Endpoint+"/v1/datacenters/"+dc+"/namespaces"), cfg).Send(req).EndBytes()
-
-	if errs != nil {
-		return "", errs
-	}
-
-	if r.StatusCode/100 != 2 {
-		resp := string(body[:])
-		errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		return resp, errs
-	} else {
-		return "namespace(s) has been created.", errs
-	}
+func (c *Client) CreateNamespace(ctx context.Context, req NamespaceRequest, dc string) error {
+	return c.doJSON(ctx, "POST", "/v1/datacenters/"+dc+"/namespaces", req, nil)
 }
@@ -0,0 +1,73 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"context"
+	"net/url"
+)
+
+/**
+ * {
+ * 	 "repository": "xs4s",
+ * 	 "slug": "iptv/xs4s",
+ * 	 "id": 8272,
+ * 	 "hook": {
+ *     "is_active": true,
+ *     "id": 3775
+ *   },
+ * 	 "owner": "iptv",
+ * 	 "access": "push"
+ * }
+ */
+
+type RepoHook struct {
+	IsActive bool `json:"is_active"`
+	Id       int  `json:"id"`
+}
+
+type RepoSummary struct {
+	Repository string    `json:"repository"`
+	Slug       string    `json:"slug"`
+	Id         int       `json:"id"`
+	Hook       *RepoHook `json:"hook"`
+	Owner      string    `json:"owner"`
+	Access     string    `json:"access"`
+}
+
+func (c *Client) SyncRepos(ctx context.Context) error {
+	return c.doJSON(ctx, "POST", "/v1/profile/sync", nil, nil)
+}
+
+func (c *Client) ListRepos(ctx context.Context, owner string) ([]RepoSummary, error) {
+	var list []RepoSummary
+	err := c.doJSON(ctx, "GET", "/v1/repos?owner="+url.QueryEscape(owner), nil, &list)
+	return list, err
+}
+
+type EnableRepoRequest struct {
+	Owner string `json:"owner"`
+	Repo  string `json:"repo"`
+}
+
+func (c *Client) Enable(ctx context.Context, req EnableRepoRequest) error {
+	return c.doJSON(ctx, "POST", "/v1/repos/"+req.Owner+"/"+req.Repo+"/hook", req, nil)
+}
+
+func (c *Client) Disable(ctx context.Context, req EnableRepoRequest) error {
+	return c.doJSON(ctx, "DELETE", "/v1/repos/"+req.Owner+"/"+req.Repo+"/hook", req, nil)
+}
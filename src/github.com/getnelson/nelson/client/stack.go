@@ -0,0 +1,265 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+/////////////////// MANUAL DEPLOYMENT ///////////////////
+
+/*
+ * {
+ *   "datacenter": "perryman",
+ *   "namespace": "stage",
+ *   "serviceType": "cassandra",
+ *   "version": "1.2.3,
+ *   "hash": "abcd1234",
+ *   "description": "a cassandra for great good",
+ *   "port": 1234
+ * }
+ */
+type ManualDeploymentRequest struct {
+	Datacenter  string `json:"datacenter"`
+	Namespace   string `json:"namespace"`
+	ServiceType string `json:"service_type"`
+	Version     string `json:"version"`
+	Hash        string `json:"hash"`
+	Port        int64  `json:"port"`
+	Description string `json:"description"`
+}
+
+func (c *Client) RegisterManualDeployment(ctx context.Context, req ManualDeploymentRequest) error {
+	return c.doJSON(ctx, "POST", "/v1/deployments", req, nil)
+}
+
+/////////////////// REVERSE ///////////////////
+
+func (c *Client) ReverseTrafficShift(ctx context.Context, guid string) error {
+	return c.doJSON(ctx, "POST", "/v1/deployments/"+guid+"/trafficshift/reverse", nil, nil)
+}
+
+/////////////////// INSPECT ///////////////////
+
+/*
+ * {
+ *   "timestamp": "2016-06-28T20:02:34.449Z",
+ *   "message": "instructing perryman's chronos to handle job container",
+ *   "status": "deploying"
+ * }
+ */
+type StackStatus struct {
+	Timestamp string `json:"timestamp"`
+	Message   string `json:"message"`
+	Status    string `json:"status"`
+}
+
+/*
+ *   "dependencies": {
+ *     "outbound": [
+ *      ...
+ *     ],
+ *     "inbound": []
+ *   },
+ */
+type StackDependencies struct {
+	Outbound []Stack `json:"outbound"`
+	Inbound  []Stack `json:"inbound"`
+}
+
+/*
+ * {
+ *   "workflow": "pulsar",
+ *   "guid": "e4184c271bb9",
+ *   "statuses": [
+ *     {
+ *       "timestamp": "2016-07-14T22:30:22.358Z",
+ *       "message": "inventory-inventory deployed to perryman",
+ *       "status": "ready"
+ *     },
+ *     ...
+ *   ],
+ *   "stack_name": "inventory-inventory--2-0-11--8gufie2b",
+ *   "deployed_at": 1468535384221,
+ *   "unit": "inventory-inventory",
+ *   "plan": "service",
+ *   "expiration": 1469928212871,
+ *   "dependencies": {
+ *     "outbound": [
+ *       {
+ *         "workflow": "manual",
+ *         "guid": "1a69395e919d",
+ *         "stack_name": "dev-iptv-cass-dev--4-8-4--mtq2odqzndc0mg",
+ *         "deployed_at": 1468518896093,
+ *         "unit": "dev-iptv-cass-dev",
+ *         "plan": "service"
+ *       }
+ *     ],
+ *     "inbound": []
+ *   },
+ *   "namespace": "dev"
+ * }
+ */
+type StackSummary struct {
+	Workflow     string            `json:"workflow"`
+	Guid         string            `json:"guid"`
+	StackName    string            `json:"stack_name"`
+	DeployedAt   int64             `json:"deployed_at"`
+	UnitName     string            `json:"unit"`
+	Plan         string            `json:"plan"`
+	NamespaceRef string            `json:"namespace"`
+	Expiration   int64             `json:"expiration"`
+	Statuses     []StackStatus     `json:"statuses"`
+	Dependencies StackDependencies `json:"dependencies"`
+	Resources    []string          `json:"resources"`
+}
+
+func (c *Client) InspectStack(ctx context.Context, guid string) (StackSummary, error) {
+	var result StackSummary
+	err := c.doJSON(ctx, "GET", "/v1/deployments/"+guid, nil, &result)
+	return result, err
+}
+
+/////////////////// REDEPLOYMENT ///////////////////
+
+func (c *Client) Redeploy(ctx context.Context, guid string) error {
+	return c.doJSON(ctx, "POST", "/v1/deployments/"+guid+"/redeploy", nil, nil)
+}
+
+/////////////////// LISTING STACKS ///////////////////
+
+/**
+ * {
+ *   "workflow": "quasar",
+ *   "guid": "67e04d28d6ab",
+ *   "stack_name": "blobstore-testsuite--0-1-55--kbqg9nff",
+ *   "deployed_at": 1467225866870,
+ *   "unit": "blobstore-testsuite",
+ *   "plan": "fooo",
+ *   "namespace": "dev"
+ * }
+ */
+type Stack struct {
+	Workflow     string `json:"workflow"`
+	Guid         string `json:"guid"`
+	StackName    string `json:"stack_name"`
+	DeployedAt   int64  `json:"deployed_at"`
+	UnitName     string `json:"unit"`
+	Plan         string `json:"plan"`
+	Type         string `json:"type,omitempty"`
+	NamespaceRef string `json:"namespace,omitempty"`
+	Status       string `json:"status"`
+	Weight       int64  `json:"weight,omitempty"`
+}
+
+func (c *Client) ListStacks(ctx context.Context, delimitedDcs string, delimitedNamespaces string, delimitedStatuses string, unit string) ([]Stack, error) {
+	uri := "/v1/deployments?"
+	qs := url.Values{}
+	// set the datacenters if specified
+	if isValidCommaDelimitedList(delimitedDcs) {
+		qs.Set("dc", delimitedDcs)
+	}
+	if isValidCommaDelimitedList(delimitedStatuses) {
+		qs.Set("status", delimitedStatuses)
+	} else {
+		// if the user didnt specify statuses, they probally want all the stacks except historical terminated ones.
+		qs.Set("status", "pending,deploying,warming,ready,deprecated,failed")
+	}
+	if isValidCommaDelimitedList(delimitedNamespaces) {
+		qs.Set("ns", delimitedNamespaces)
+	} else {
+		qs.Set("ns", "dev,qa,prod")
+	}
+	if unit != "" {
+		qs.Set("unit", unit)
+	}
+	uri = uri + qs.Encode()
+
+	var list []Stack
+	err := c.doJSON(ctx, "GET", uri, nil, &list)
+	return list, err
+}
+
+/////////////////// DEPLOYMENT LOG ///////////////////
+
+type StackLog struct {
+	Content []string `json:"content"`
+	Offset  int      `json:"offset"`
+}
+
+// v1/deployments/:id/log?offset=n
+//
+// Offset is the line number to start reading from; zero reads the
+// whole log. The returned Offset is that of the first line in Content.
+func (c *Client) GetDeploymentLog(ctx context.Context, guid string, offset int) (StackLog, error) {
+	uri := "/v1/deployments/" + guid + "/log"
+	if offset > 0 {
+		uri = uri + "?offset=" + strconv.Itoa(offset)
+	}
+	var logs StackLog
+	err := c.doJSON(ctx, "GET", uri, nil, &logs)
+	return logs, err
+}
+
+/////////////////// RUNTIME INSPECT ///////////////////
+
+/*
+ * {
+ *   "consul_health": [{
+ *     "check_id": "64c0a2b5bd2972c9521fb7313b00db7dad58c04c",
+ *     "node": "ip-10-113-128-190",
+ *     "status": "passing",
+ *     "name": "service: default howdy-http--1-0-344--9uuu1mp2 check"
+ *   }],
+ *   "scheduler": {
+ *     "failed": 0,
+ *     "completed": 0,
+ *     "pending": 0,
+ *     "running": 1
+ *   },
+ *   "current_status": "ready",
+ *   "expires_at" : 10101333
+ * }
+ */
+type StackRuntime struct {
+	CurrentStatus string                `json:"current_status"`
+	ExpiresAt     int64                 `json:"expires_at"`
+	Scheduler     StackRuntimeScheduler `json:"scheduler"`
+	ConsulHealth  []StackRuntimeHealth  `json:"consul_health"`
+}
+
+type StackRuntimeHealth struct {
+	CheckId string `json:"check_id"`
+	Node    string `json:"node"`
+	Status  string `json:"status"`
+	Name    string `json:"name"`
+}
+
+type StackRuntimeScheduler struct {
+	Failed    int `json:"failed"`
+	Completed int `json:"completed"`
+	Pending   int `json:"pending"`
+	Running   int `json:"running"`
+}
+
+func (c *Client) GetStackRuntime(ctx context.Context, guid string) (StackRuntime, error) {
+	var runtime StackRuntime
+	err := c.doJSON(ctx, "GET", "/v1/deployments/"+guid+"/runtime", nil, &runtime)
+	return runtime, err
+}
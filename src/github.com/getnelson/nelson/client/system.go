@@ -0,0 +1,59 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"context"
+)
+
+/*
+ * {
+ *   "description": "retains the latest version",
+ *   "policy": "retain-latest"
+ * }
+ */
+type CleanupPolicy struct {
+	Description string `json:"description"`
+	Policy      string `json:"policy"`
+}
+
+func (c *Client) ListCleanupPolicies(ctx context.Context) ([]CleanupPolicy, error) {
+	var list []CleanupPolicy
+	err := c.doJSON(ctx, "GET", "/v1/cleanup-policies", nil, &list)
+	return list, err
+}
+
+type BuildInfoResponse struct {
+	BuildInfo BuildInfo `json:"build_info"`
+	Banner    string    `json:"banner"`
+}
+
+type BuildInfo struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	ScalaVersion string `json:"scala_version"`
+	SbtVersion   string `json:"sbt_version"`
+	GitRevision  string `json:"git_revision"`
+	BuildDate    string `json:"build_date"`
+}
+
+// GET /build-info
+func (c *Client) WhoAreYou(ctx context.Context) (BuildInfoResponse, error) {
+	var resp BuildInfoResponse
+	err := c.doJSON(ctx, "GET", "/v1/build-info", nil, &resp)
+	return resp, err
+}
@@ -0,0 +1,99 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TLSOptions configure how a Client verifies Nelson and, for mutual
+// TLS, identifies itself.
+type TLSOptions struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name the server certificate must match.
+	ServerName string
+	// InsecureSkipVerify disables verification of the server entirely.
+	InsecureSkipVerify bool
+}
+
+// NewTransport returns a transport using the given TLS options that
+// sends every request through proxy. An empty proxy falls back to the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func NewTransport(opts TLSOptions, proxy string) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         opts.ServerName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+
+	if len(opts.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no PEM certificates could be read from " + opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(opts.CertFile) > 0 || len(opts.KeyFile) > 0 {
+		if len(opts.CertFile) == 0 || len(opts.KeyFile) == 0 {
+			return nil, errors.New("a client certificate needs both a cert file and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	proxyFunc := http.ProxyFromEnvironment
+	if len(proxy) > 0 {
+		u, err := url.Parse(proxy)
+		if err != nil || len(u.Host) == 0 {
+			return nil, errors.New("the proxy '" + proxy + "' is not a valid url")
+		}
+		proxyFunc = http.ProxyURL(u)
+	}
+
+	return &http.Transport{
+		Proxy: proxyFunc,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}, nil
+}
@@ -0,0 +1,153 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const whoAmIBody = `{"user": {"login": "octocat"}}`
+
+func newTransportClient(t *testing.T, endpoint string, opts TLSOptions, proxy string) *Client {
+	transport, err := NewTransport(opts, proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(endpoint, Session{SessionToken: "abc"})
+	c.HTTPClient.Transport = transport
+	c.Retries = 0
+	return c
+}
+
+func writePEM(t *testing.T, path string, kind string, der []byte) {
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransportTrustsCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(whoAmIBody))
+	}))
+	defer server.Close()
+
+	untrusted := newTransportClient(t, server.URL, TLSOptions{}, "")
+	if _, err := untrusted.WhoAmI(context.Background()); err == nil {
+		t.Fatal("expected the test server certificate to be rejected without a CA file")
+	}
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, ca, "CERTIFICATE", server.Certificate().Raw)
+	trusted := newTransportClient(t, server.URL, TLSOptions{CAFile: ca}, "")
+	if _, err := trusted.WhoAmI(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransportRejectsUnreadableCAFile(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(ca, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTransport(TLSOptions{CAFile: ca}, ""); err == nil {
+		t.Fatal("expected an error for a CA file without certificates")
+	}
+	if _, err := NewTransport(TLSOptions{CertFile: ca}, ""); err == nil {
+		t.Fatal("expected an error for a cert file without a key file")
+	}
+}
+
+func TestTransportPresentsClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "nelson-cli" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(whoAmIBody))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "nelson-cli"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writePEM(t, filepath.Join(dir, "client.pem"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, "client-key.pem"), "EC PRIVATE KEY", keyDer)
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", server.Certificate().Raw)
+
+	c := newTransportClient(t, server.URL, TLSOptions{
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		CertFile: filepath.Join(dir, "client.pem"),
+		KeyFile:  filepath.Join(dir, "client-key.pem"),
+	}, "")
+	if _, err := c.WhoAmI(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransportUsesExplicitProxy(t *testing.T) {
+	var proxiedHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHost = r.URL.Host
+		w.Write([]byte(whoAmIBody))
+	}))
+	defer proxy.Close()
+
+	c := newTransportClient(t, "http://nelson.example.com", TLSOptions{}, proxy.URL)
+	if _, err := c.WhoAmI(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if proxiedHost != "nelson.example.com" {
+		t.Fatalf("expected the request to go through the proxy, got host %q", proxiedHost)
+	}
+
+	if _, err := NewTransport(TLSOptions{}, "::not a url"); err == nil {
+		t.Fatal("expected an error for an invalid proxy")
+	}
+}
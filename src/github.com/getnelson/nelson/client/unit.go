@@ -0,0 +1,123 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"context"
+)
+
+/*
+ * {
+ *   "guid": "3fbc7381a664",
+ *   "namespace": "dev",
+ *   "service_type": "heydiddlyho-http",
+ *   "version": {
+ *     "major": 0,
+ *     "minor": 33
+ *   }
+ * }
+ */
+type UnitSummary struct {
+	Guid         string         `json:"guid"`
+	NamespaceRef string         `json:"namespace"`
+	ServiceType  string         `json:"service_type"`
+	Version      FeatureVersion `json:"version"`
+}
+
+type FeatureVersion struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+}
+
+/*
+ * {
+ *   "policies": [ "foo", "bar", "baz" ]
+ * }
+ */
+type PolicyList struct {
+	Policies []string `json:"policies"`
+}
+
+/////////////////// LIST ///////////////////
+
+func (c *Client) ListUnits(ctx context.Context, delimitedDcs string, delimitedNamespaces string, delimitedStatuses string) ([]UnitSummary, error) {
+	uri := "/v1/units?"
+	// set the datacenters if specified
+	if isValidCommaDelimitedList(delimitedDcs) {
+		uri = uri + "dc=" + delimitedDcs + "&"
+	}
+	if isValidCommaDelimitedList(delimitedStatuses) {
+		uri = uri + "status=" + delimitedStatuses + "&"
+	} else {
+		// if the user didnt specify statuses, they probally only want ready units.
+		uri = uri + "status=ready,warming,manual&"
+	}
+	if isValidCommaDelimitedList(delimitedNamespaces) {
+		uri = uri + "ns=" + delimitedNamespaces
+	} else {
+		uri = uri + "ns=dev,qa,prod"
+	}
+
+	var list []UnitSummary
+	err := c.doJSON(ctx, "GET", uri, nil, &list)
+	return list, err
+}
+
+/////////////////// DEPRECATION ///////////////////
+
+/*
+ * {
+ *   "service_type": "heydiddlyho-http",
+ *   "version":{
+ *     "major":1,
+ *     "minor":33
+ *   }
+ * }
+ */
+type DeprecationExpiryRequest struct {
+	ServiceType string         `json:"service_type"`
+	Version     FeatureVersion `json:"version"`
+}
+
+func (c *Client) Deprecate(ctx context.Context, req DeprecationExpiryRequest) error {
+	return c.doJSON(ctx, "POST", "/v1/units/deprecate", req, nil)
+}
+
+/////////////////// EXPIRATION ///////////////////
+
+func (c *Client) Expire(ctx context.Context, req DeprecationExpiryRequest) error {
+	return c.doJSON(ctx, "POST", "/v1/units/expire", req, nil)
+}
+
+/////////////////// COMMITING ///////////////////
+
+/*
+* {
+*   "unit": "foo",
+*   "version": "1.2.3",
+*   "target": "qa"
+* }
+ */
+type CommitRequest struct {
+	UnitName string `json:"unit"`
+	Version  string `json:"version"`
+	Target   string `json:"target"`
+}
+
+func (c *Client) CommitUnit(ctx context.Context, req CommitRequest) error {
+	return c.doJSON(ctx, "POST", "/v1/units/commit", req, nil)
+}
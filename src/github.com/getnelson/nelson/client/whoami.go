@@ -0,0 +1,38 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package client
+
+import (
+	"context"
+)
+
+type SessionResponse struct {
+	User User `json:"user"`
+}
+
+type User struct {
+	Login  string `json:"login"`
+	Name   string `json:"name"`
+	Avatar string `json:"avatar"`
+}
+
+// GET /session
+func (c *Client) WhoAmI(ctx context.Context) (SessionResponse, error) {
+	var resp SessionResponse
+	err := c.doJSON(ctx, "GET", "/session", nil, &resp)
+	return resp, err
+}
@@ -0,0 +1,133 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// set by --format, --columns and --no-headers; see RenderList.
+var globalFormat string
+var globalColumns string
+var globalNoHeaders bool
+
+// Column is one column of a list table. Name is what --columns selects
+// it by, and matches the json field the column is derived from.
+type Column struct {
+	Name   string
+	Header string
+	Value  func(row interface{}) string
+	// only shown when asked for with --columns
+	Optional bool
+}
+
+// RenderList writes the rows of a list command, a slice, as a table of
+// the given columns. --columns picks and orders the columns, --no-headers
+// drops the header row, and --format replaces the table entirely with a
+// go template executed once per row, e.g. '{{.Guid}} {{.StackName}}'.
+func RenderList(rows interface{}, columns []Column) {
+	if err := renderList(os.Stdout, rows, columns, globalFormat, globalColumns, !globalNoHeaders); err != nil {
+		PrintTerminalErrors([]error{err})
+		os.Exit(1)
+	}
+}
+
+func renderList(w io.Writer, rows interface{}, columns []Column, format string, selected string, headers bool) error {
+	values := reflect.ValueOf(rows)
+	if len(format) > 0 {
+		return renderTemplate(w, values, format)
+	}
+
+	columns, err := selectColumns(columns, selected)
+	if err != nil {
+		return err
+	}
+	data := [][]string{}
+	for i := 0; i < values.Len(); i++ {
+		row := []string{}
+		for _, c := range columns {
+			row = append(row, c.Value(values.Index(i).Interface()))
+		}
+		data = append(data, row)
+	}
+	var names []string
+	if headers {
+		for _, c := range columns {
+			names = append(names, c.Header)
+		}
+	}
+	renderTable(w, names, data)
+	return nil
+}
+
+func renderTemplate(w io.Writer, rows reflect.Value, format string) error {
+	if !strings.HasSuffix(format, "\n") {
+		format = format + "\n"
+	}
+	t, err := template.New("format").Option("missingkey=error").Parse(format)
+	if err != nil {
+		return errors.New("Invalid --format template: " + err.Error())
+	}
+	for i := 0; i < rows.Len(); i++ {
+		if err := t.Execute(w, rows.Index(i).Interface()); err != nil {
+			return errors.New("Unable to apply the --format template: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// the default columns when selected is empty, otherwise those it names
+// as a comma delimited list, in the order given.
+func selectColumns(columns []Column, selected string) ([]Column, error) {
+	out := []Column{}
+	if len(strings.TrimSpace(selected)) == 0 {
+		for _, c := range columns {
+			if !c.Optional {
+				out = append(out, c)
+			}
+		}
+		return out, nil
+	}
+	for _, name := range strings.Split(selected, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, c := range columns {
+			if c.Name == name {
+				out = append(out, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("Unknown column '" + name + "'; the available columns are " + columnNames(columns))
+		}
+	}
+	return out, nil
+}
+
+func columnNames(columns []Column) string {
+	names := []string{}
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,89 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/getnelson/nelson/client"
+)
+
+var columnTestStacks = []client.Stack{
+	{Guid: "aaa", StackName: "howdy-http--1-0-0--aaa", Status: "ready", UnitName: "howdy-http"},
+	{Guid: "bbb", StackName: "howdy-http--1-0-1--bbb", Status: "deploying", UnitName: "howdy-http"},
+}
+
+func TestRenderListSelectsColumns(t *testing.T) {
+	var out bytes.Buffer
+	if err := renderList(&out, columnTestStacks, stackColumns, "", "status, guid,unit", true); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and two rows, got %q", out.String())
+	}
+	if got := strings.Fields(lines[0]); strings.Join(got, " ") != "STATUS GUID UNIT" {
+		t.Errorf("unexpected header %v", got)
+	}
+	if got := strings.Fields(lines[2]); strings.Join(got, " ") != "deploying bbb howdy-http" {
+		t.Errorf("unexpected row %v", got)
+	}
+}
+
+func TestRenderListWithoutHeaders(t *testing.T) {
+	var out bytes.Buffer
+	if err := renderList(&out, columnTestStacks, stackColumns, "", "guid", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(out.String()); strings.Join(got, " ") != "aaa bbb" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestRenderListDefaultsToRequiredColumns(t *testing.T) {
+	var out bytes.Buffer
+	if err := renderList(&out, columnTestStacks, stackColumns, "", "", true); err != nil {
+		t.Fatal(err)
+	}
+	header := strings.Split(out.String(), "\n")[0]
+	if !strings.Contains(header, "DEPLOYED AT") || strings.Contains(header, "UNIT") {
+		t.Errorf("unexpected default header %q", header)
+	}
+}
+
+func TestRenderListRejectsUnknownColumns(t *testing.T) {
+	var out bytes.Buffer
+	err := renderList(&out, columnTestStacks, stackColumns, "", "guid,colour", true)
+	if err == nil || !strings.Contains(err.Error(), "colour") || !strings.Contains(err.Error(), "deployed_at") {
+		t.Errorf("expected an error naming the column and the alternatives, got %v", err)
+	}
+}
+
+func TestRenderListAppliesTemplate(t *testing.T) {
+	var out bytes.Buffer
+	if err := renderList(&out, columnTestStacks, stackColumns, "{{.Guid}} {{.StackName}}", "", true); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "aaa howdy-http--1-0-0--aaa\nbbb howdy-http--1-0-1--bbb\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if err := renderList(&out, columnTestStacks, stackColumns, "{{.Colour}}", "", true); err == nil {
+		t.Error("expected an error for a field the rows do not have")
+	}
+}
@@ -17,80 +17,130 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/parnurzeal/gorequest"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/getnelson/nelson/client"
 )
 
 ///////////////////////////// CLI ENTRYPOINT //////////////////////////////////
 
-func LoadDefaultConfigOrExit(http *gorequest.SuperAgent) *Config {
+// LoadDefaultConfigOrExit picks the config for this invocation from the
+// first of these that applies:
+//
+//  1. the context named by --context, from the config file;
+//  2. NELSON_ADDR and NELSON_SESSION_TOKEN, an existing session;
+//  3. the current context of the config file;
+//  4. NELSON_ADDR and GITHUB_TOKEN, when there is no config file at all.
+//
+// Configs taken from the environment are never written to disk.
+func LoadDefaultConfigOrExit() *Config {
+	if len(globalContext) == 0 {
+		if cfg := sessionFromEnvironment(); cfg != nil {
+			return cfg
+		}
+		if _, err := os.Stat(configFilePath()); os.IsNotExist(err) && canLoginFromEnvironment() {
+			cfg, e := createSessionInMemory(context.Background(), &Config{Endpoint: endpointFromEnvironment()})
+			if e != nil {
+				bailout([]error{e})
+			}
+			return cfg
+		}
+	}
+
 	pth := defaultConfigPath()
 	errout := []error{}
 
 	_, err := os.Stat(pth)
 
 	if os.IsNotExist(err) {
-		errout = append(errout, errors.New("No config file existed at "+pth+". You need to `nelson login` before running other commands."))
+		errout = append(errout, errors.New("No config file existed at "+pth+". You need to `nelson login` before running other commands, or set NELSON_ADDR along with NELSON_SESSION_TOKEN or GITHUB_TOKEN."))
 	}
 
-	x, parsed := readConfigFile(pth)
+	x, file := readConfigFile(pth)
 
 	if x != nil {
 		errout = append(errout, errors.New("Unable to read configuration file at '"+pth+"'. Reported error was: "+x.Error()))
 	}
 
+	// configuration file does not exist
+	if err != nil {
+		bailout(errout)
+	}
+
+	name := file.selectContextName(globalContext)
+	parsed, ce := file.loadConfig(name)
+	if ce != nil {
+		bailout(append(errout, ce))
+	}
+
 	ve := parsed.Validate()
+	renewWithin, warnWithin := file.sessionWindows()
+	remaining := parsed.ExpiresIn()
 
-	if ve != nil {
-		errout = append(errout, ve...) // TIM: wtf golang, ... means "expand these as vararg function application"
+	// an expired session has to be renewed before we can go on; one that
+	// is merely close to expiry is renewed whenever that can happen
+	// without asking the user.
+	if len(globalContext) > 0 {
+		parsed.source = configSourceFlag
 	}
 
-	// if there are errors loading the config, assume its an expired
-	// token and try to regenerate the configuration
-	if errout != nil {
-		// configuration file does not exist
-		if err != nil {
-			bailout(errout)
+	if len(ve) > 0 || (remaining < renewWithin && canRenewSession()) {
+		refreshed, x := renewSession(context.Background(), parsed)
+		if x == nil {
+			return refreshed
 		}
-
 		if len(ve) > 0 {
-			// retry the login based on information we know
-			x := attemptConfigRefresh(http, parsed)
-			// if that didnt help, then bail out and report the issue to the user.
-			if x != nil {
-				errout = append(errout, x...)
-				bailout(errout)
-			}
-			_, contents := readConfigFile(pth)
-			return contents
+			errout = append(errout, ve...) // TIM: wtf golang, ... means "expand these as vararg function application"
+			bailout(append(errout, x))
 		}
+		fmt.Fprintln(os.Stderr, "===>> Unable to renew the session for context '"+name+"': "+x.Error())
+	}
+	if remaining < warnWithin {
+		fmt.Fprintln(os.Stderr, "===>> Your session for context '"+name+"' expires "+javaEpochToHumanizedTime(parsed.ExpiresAt)+
+			"; run 'nelson login' again, or set GITHUB_TOKEN to have it renewed automatically.")
 	}
 	// if regular loading of the config worked, then
 	// just go with that! #happypath
 	return parsed
 }
 
-func attemptConfigRefresh(http *gorequest.SuperAgent, existing *Config) []error {
-	errout := []error{}
-	var ghToken string = os.Getenv("GITHUB_TOKEN")
-	e, u := hostFromUri(existing.Endpoint)
-	if e != nil {
-		return []error{e}
+func canRenewSession() bool {
+	return len(os.Getenv("GITHUB_TOKEN")) > 0
+}
+
+// renews the session of a context by logging in again with the
+// GITHUB_TOKEN from the environment, and returns the renewed config.
+func renewSession(ctx context.Context, existing *Config) (*Config, error) {
+	if !canRenewSession() {
+		return nil, errors.New("Environment GITHUB_TOKEN variable not defined, so the session cannot be renewed.")
 	}
-	if len([]rune(ghToken)) == 0 {
-		errout = append(errout, errors.New("Environment GITHUB_TOKEN variable not defined. "))
-		bailout(errout)
-		// return []error{errout}
+	if existing.fromEnvironment() {
+		return createSessionInMemory(ctx, existing)
+	}
+	if err := Login(ctx, os.Getenv("GITHUB_TOKEN"), existing.contextName, *existing); err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr, "===>> Renewed the session for context '"+existing.contextName+"'.")
+
+	x, file := readConfigFile(defaultConfigPath())
+	if x != nil {
+		return nil, x
+	}
+	renewed, err := file.loadConfig(existing.contextName)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println("Attempted token refresh...")
-	return Login(http, ghToken, u, false)
+	renewed.source = existing.source
+	return renewed, nil
 }
 
 func bailout(errors []error) {
@@ -102,9 +152,48 @@ func bailout(errors []error) {
 
 ////////////////////////////// CONFIG YAML ///////////////////////////////////
 
+const defaultContextName = "default"
+
+/*
+ * ---
+ * current_context: staging
+ * contexts:
+ * - name: staging
+ *   endpoint: https://nelson.staging.yourcompany.com
+ *   session:
+ *     token: xxx
+ *     expires_at: 1234
+ */
+type ConfigFile struct {
+	CurrentContext string          `yaml:"current_context"`
+	Contexts       []ConfigContext `yaml:"contexts"`
+	// how close to expiry a session is renewed (when GITHUB_TOKEN is set)
+	// and warned about, as durations such as "10m"; see sessionWindows.
+	RenewWithin string `yaml:"renew_within,omitempty"`
+	WarnWithin  string `yaml:"warn_within,omitempty"`
+	// where session tokens are kept; see credentialStore.
+	CredentialStore  string `yaml:"credential_store,omitempty"`
+	CredentialHelper string `yaml:"credential_helper,omitempty"`
+}
+
+type ConfigContext struct {
+	Name   string `yaml:"name"`
+	Config `yaml:",inline"`
+}
+
 type Config struct {
-	Endpoint      string `yaml:endpoint`
+	Endpoint string `yaml:"endpoint"`
+	// how the session is sent: "cookie" (the default) or "bearer"
+	Auth          string `yaml:"auth,omitempty"`
 	ConfigSession `yaml:"session"`
+	TLS           ConfigTLS `yaml:"tls,omitempty"`
+	// an explicit http(s) proxy; otherwise HTTPS_PROXY and friends apply
+	Proxy string `yaml:"proxy,omitempty"`
+
+	// the context this was loaded from, if any; needed to renew it
+	contextName string
+	// where this config came from, as reported by `nelson whoami`
+	source string
 }
 
 type ConfigSession struct {
@@ -112,33 +201,48 @@ type ConfigSession struct {
 	ExpiresAt int64  `yaml:"expires_at"`
 }
 
-func (c *Config) GetAuthCookie() *http.Cookie {
-	expire := time.Now().AddDate(0, 0, 1)
-	cookie := &http.Cookie{
-		Name:       "nelson.session",
-		Value:      c.ConfigSession.Token,
-		Path:       "/",
-		Domain:     "nelson.yourcompany.com",
-		Expires:    expire,
-		RawExpires: expire.Format(time.UnixDate),
-		MaxAge:     86400,
-		Secure:     true,
-		HttpOnly:   false,
-	}
+// how the endpoint of a context is verified, and how the cli identifies
+// itself to it when nelson sits behind mutual TLS.
+type ConfigTLS struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
 
-	return cookie
+// the same settings with relative paths made absolute, so that they keep
+// working from any directory once saved.
+func (t ConfigTLS) absolute() ConfigTLS {
+	for _, p := range []*string{&t.CAFile, &t.CertFile, &t.KeyFile} {
+		if len(*p) > 0 && !strings.HasPrefix(*p, "~") {
+			if abs, err := filepath.Abs(*p); err == nil {
+				*p = abs
+			}
+		}
+	}
+	return t
 }
 
-func generateConfigYaml(s Session, url string) string {
-	temp := &Config{
-		Endpoint: url,
-		ConfigSession: ConfigSession{
-			Token:     s.SessionToken,
-			ExpiresAt: s.ExpiresAt,
-		},
+func (t ConfigTLS) options() client.TLSOptions {
+	return client.TLSOptions{
+		CAFile:             expandHome(t.CAFile),
+		CertFile:           expandHome(t.CertFile),
+		KeyFile:            expandHome(t.KeyFile),
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
 	}
+}
+
+// the single-endpoint layout written by older versions of the cli,
+// which is migrated into a context named "default" when read.
+type legacyConfigFile struct {
+	Endpoint      string         `yaml:"endpoint"`
+	ConfigSession *ConfigSession `yaml:"session"`
+}
 
-	d, err := yaml.Marshal(&temp)
+func generateConfigYaml(f *ConfigFile) string {
+	d, err := yaml.Marshal(f)
 	if err != nil {
 		log.Fatalf("error: %v", err)
 	}
@@ -146,16 +250,51 @@ func generateConfigYaml(s Session, url string) string {
 	return "---\n" + string(d)
 }
 
-func parseConfigYaml(yamlAsBytes []byte) *Config {
-	temp := &Config{}
+func parseConfigYaml(yamlAsBytes []byte) *ConfigFile {
+	temp := &ConfigFile{}
 	err := yaml.Unmarshal(yamlAsBytes, &temp)
 	if err != nil {
 		log.Fatalf("error: %v", err)
 	}
 
+	if len(temp.Contexts) == 0 {
+		legacy := &legacyConfigFile{}
+		if err := yaml.Unmarshal(yamlAsBytes, &legacy); err == nil && len(legacy.Endpoint) > 0 {
+			cfg := Config{Endpoint: legacy.Endpoint}
+			if legacy.ConfigSession != nil {
+				cfg.ConfigSession = *legacy.ConfigSession
+			}
+			temp.SetContext(defaultContextName, cfg)
+			temp.CurrentContext = defaultContextName
+		}
+	}
+
 	return temp
 }
 
+// the time left before the session expires; negative once it has.
+func (c *Config) ExpiresIn() time.Duration {
+	return time.Duration(c.ConfigSession.ExpiresAt-currentTimeMillis()) * time.Millisecond
+}
+
+const (
+	defaultRenewWithin = 10 * time.Minute
+	defaultWarnWithin  = time.Hour
+)
+
+// the windows before expiry in which sessions are renewed and warned
+// about, falling back to the defaults when unset or unparseable.
+func (f *ConfigFile) sessionWindows() (renew time.Duration, warn time.Duration) {
+	renew, warn = defaultRenewWithin, defaultWarnWithin
+	if d, err := time.ParseDuration(f.RenewWithin); err == nil {
+		renew = d
+	}
+	if d, err := time.ParseDuration(f.WarnWithin); err == nil {
+		warn = d
+	}
+	return renew, warn
+}
+
 func (c *Config) Validate() []error {
 	// check that the token has not expired
 	errs := []error{}
@@ -166,25 +305,197 @@ func (c *Config) Validate() []error {
 	return errs
 }
 
+////////////////////////////// CONTEXTS ///////////////////////////////////
+
+// the --context flag always wins; otherwise use whatever
+// context was last selected with `nelson context use`.
+func (f *ConfigFile) selectContextName(override string) string {
+	if len(override) > 0 {
+		return override
+	}
+	if len(f.CurrentContext) > 0 {
+		return f.CurrentContext
+	}
+	return defaultContextName
+}
+
+func (f *ConfigFile) indexOfContext(name string) int {
+	for i, c := range f.Contexts {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// the config of the named context, with its session token fetched
+// from the credential store.
+func (f *ConfigFile) loadConfig(name string) (*Config, error) {
+	cc, err := f.GetContext(name)
+	if err != nil {
+		return nil, err
+	}
+	store, err := f.credentialStore()
+	if err != nil {
+		return nil, err
+	}
+	cfg := cc.Config
+	if cfg.Token, err = store.Get(name); err != nil {
+		return nil, err
+	}
+	cfg.contextName = name
+	cfg.source = configSourceFile
+	return &cfg, nil
+}
+
+func (f *ConfigFile) GetContext(name string) (*ConfigContext, error) {
+	i := f.indexOfContext(name)
+	if i < 0 {
+		return nil, errors.New("No context named '" + name + "' exists. Use `nelson --context " + name + " login` to create it.")
+	}
+	return &f.Contexts[i], nil
+}
+
+// inserts or replaces the named context. The first context to be
+// added to an empty file also becomes the current context.
+func (f *ConfigFile) SetContext(name string, cfg Config) {
+	i := f.indexOfContext(name)
+	if i < 0 {
+		f.Contexts = append(f.Contexts, ConfigContext{Name: name, Config: cfg})
+	} else {
+		f.Contexts[i].Config = cfg
+	}
+	if len(f.CurrentContext) == 0 {
+		f.CurrentContext = name
+	}
+}
+
+func (f *ConfigFile) UseContext(name string) error {
+	if _, err := f.GetContext(name); err != nil {
+		return err
+	}
+	f.CurrentContext = name
+	return nil
+}
+
+func (f *ConfigFile) RenameContext(from string, to string) error {
+	i := f.indexOfContext(from)
+	if i < 0 {
+		return errors.New("No context named '" + from + "' exists.")
+	}
+	if f.indexOfContext(to) >= 0 {
+		return errors.New("A context named '" + to + "' already exists.")
+	}
+	f.Contexts[i].Name = to
+	if f.CurrentContext == from {
+		f.CurrentContext = to
+	}
+	return nil
+}
+
+func (f *ConfigFile) DeleteContext(name string) error {
+	i := f.indexOfContext(name)
+	if i < 0 {
+		return errors.New("No context named '" + name + "' exists.")
+	}
+	f.Contexts = append(f.Contexts[:i], f.Contexts[i+1:]...)
+	if f.CurrentContext == name {
+		f.CurrentContext = ""
+	}
+	return nil
+}
+
 /////////////////////////////// CONFIG I/O ////////////////////////////////////
 
 func defaultConfigPath() string {
-	targetDir := os.Getenv("HOME") + "/.nelson"
-	os.Mkdir(targetDir, 0775)
-	return targetDir + "/config.yml"
+	os.Mkdir(filepath.Dir(configFilePath()), 0700)
+	return configFilePath()
 }
 
-// returns Unit, no error handling. YOLO
-func writeConfigFile(s Session, url string, configPath string) {
-	yamlConfig := generateConfigYaml(s, url)
+// the same path, without creating its directory.
+func configFilePath() string {
+	return os.Getenv("HOME") + "/.nelson/config.yml"
+}
 
-	err := ioutil.WriteFile(configPath, []byte(yamlConfig), 0755)
-	if err != nil {
-		panic(err)
+// paths in the config file may be written relative to the home directory.
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return os.Getenv("HOME") + path[1:]
 	}
+	return path
+}
+
+// the config file holds session tokens, so only its owner may read it.
+const configFileMode = 0600
+
+// writes the file under a lock, replacing it atomically so that
+// concurrent readers never see a partial file.
+func writeConfigFile(f *ConfigFile, configPath string) error {
+	return withConfigLock(configPath, func() error {
+		return writeFileAtomic(configPath, []byte(generateConfigYaml(f)), configFileMode)
+	})
 }
 
-func readConfigFile(configPath string) (error, *Config) {
+// reads, modifies and writes back the config file while holding its
+// lock, so that concurrent runs cannot lose each other's changes. A
+// missing file is treated as an empty one.
+func updateConfigFile(configPath string, modify func(*ConfigFile) error) error {
+	return withConfigLock(configPath, func() error {
+		err, file := readConfigFile(configPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := modify(file); err != nil {
+			return err
+		}
+		return writeFileAtomic(configPath, []byte(generateConfigYaml(file)), configFileMode)
+	})
+}
+
+func readConfigFile(configPath string) (error, *ConfigFile) {
 	b, err := ioutil.ReadFile(configPath)
+	if err == nil {
+		restrictConfigPermissions(configPath)
+	}
 	return err, parseConfigYaml(b) // TIM: parsing never fails, right? ;-)
 }
+
+// files written by older versions of the cli were world readable.
+func restrictConfigPermissions(configPath string) {
+	info, err := os.Stat(configPath)
+	if err != nil || info.Mode().Perm()&0077 == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "===>> %s was readable by other users (mode %o); restricting it to %o.\n", configPath, info.Mode().Perm(), configFileMode)
+	if err := os.Chmod(configPath, configFileMode); err != nil {
+		fmt.Fprintln(os.Stderr, "===>> Unable to change its permissions: "+err.Error())
+	}
+	os.Chmod(filepath.Dir(configPath), 0700)
+}
+
+// writes data to a temporary file next to path and renames it into
+// place, so the file at path is always either the old or the new one.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // a no-op once renamed
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -19,16 +19,24 @@ package main
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestGenerateConfigYaml(t *testing.T) {
-	sess := Session{SessionToken: "abc", ExpiresAt: 1234}
-	cfg := generateConfigYaml(sess, "http://foo.com")
+	file := &ConfigFile{}
+	file.SetContext("default", Config{
+		Endpoint:      "http://foo.com",
+		ConfigSession: ConfigSession{Token: "abc", ExpiresAt: 1234},
+	})
+	cfg := generateConfigYaml(file)
 	fixture := `---
-endpoint: http://foo.com
-session:
-  token: abc
-  expires_at: 1234
+current_context: default
+contexts:
+- name: default
+  endpoint: http://foo.com
+  session:
+    token: abc
+    expires_at: 1234
 `
 
 	if cfg != fixture {
@@ -38,29 +46,79 @@ session:
 
 func TestRoundTripConfigFile(t *testing.T) {
 	host := "http://foo.com"
-	sess := Session{SessionToken: "abc", ExpiresAt: 1234}
 	path := "/tmp/nelson-cli-config-test.yml"
 	expected := Config{
 		Endpoint: host,
 		ConfigSession: ConfigSession{
-			Token:     sess.SessionToken,
-			ExpiresAt: sess.ExpiresAt,
+			Token:     "abc",
+			ExpiresAt: 1234,
 		},
 	}
+	file := &ConfigFile{}
+	file.SetContext("staging", expected)
 
-	writeConfigFile(sess, host, path)
+	if err := writeConfigFile(file, path); err != nil {
+		t.Fatal("Unable to write the config file", err)
+	}
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	if info, err := os.Stat(path); os.IsNotExist(err) {
 		t.Error("Expected a file to exist at ", path)
+	} else if info.Mode().Perm() != configFileMode {
+		t.Errorf("Expected the config file to have mode %o, got %o", configFileMode, info.Mode().Perm())
 	}
 
 	_, loadedCfg := readConfigFile(path)
+	ctx, err := loadedCfg.GetContext("staging")
 
-	if expected != *loadedCfg {
+	if err != nil || expected != ctx.Config {
 		t.Error(expected, loadedCfg)
 	}
 }
 
+func TestParseLegacyConfigYaml(t *testing.T) {
+	fixture := `---
+endpoint: http://foo.com
+session:
+  token: abc
+  expires_at: 1234
+`
+	file := parseConfigYaml([]byte(fixture))
+
+	if file.CurrentContext != "default" {
+		t.Error("Expected the legacy config to become the current context, but got", file.CurrentContext)
+	}
+
+	ctx, err := file.GetContext("default")
+	if err != nil || ctx.Endpoint != "http://foo.com" || ctx.Token != "abc" {
+		t.Error("Expected the legacy config to be migrated, but got", file)
+	}
+}
+
+func TestContextLifecycle(t *testing.T) {
+	file := &ConfigFile{}
+	file.SetContext("staging", Config{Endpoint: "https://staging"})
+	file.SetContext("prod", Config{Endpoint: "https://prod"})
+
+	if file.selectContextName("") != "staging" {
+		t.Error("Expected the first context to be current, but got", file.CurrentContext)
+	}
+	if file.selectContextName("prod") != "prod" {
+		t.Error("Expected the override to win")
+	}
+	if err := file.UseContext("missing"); err == nil {
+		t.Error("Expected an error when using an unknown context")
+	}
+	if err := file.RenameContext("staging", "prod"); err == nil {
+		t.Error("Expected an error when renaming onto an existing context")
+	}
+	if err := file.RenameContext("staging", "stage"); err != nil || file.CurrentContext != "stage" {
+		t.Error("Expected the current context to follow the rename, but got", file.CurrentContext)
+	}
+	if err := file.DeleteContext("stage"); err != nil || len(file.Contexts) != 1 || file.CurrentContext != "" {
+		t.Error("Expected the context to be deleted, but got", file)
+	}
+}
+
 func TestConfigValidate(t *testing.T) {
 	c := Config{
 		Endpoint: "foo.bar.com",
@@ -74,3 +132,24 @@ func TestConfigValidate(t *testing.T) {
 		t.Error(1, len(c.Validate()))
 	}
 }
+
+func TestSessionWindows(t *testing.T) {
+	f := &ConfigFile{}
+	renew, warn := f.sessionWindows()
+	if renew != defaultRenewWithin || warn != defaultWarnWithin {
+		t.Error("expected the default windows, got", renew, warn)
+	}
+
+	f = &ConfigFile{RenewWithin: "30m", WarnWithin: "nonsense"}
+	renew, warn = f.sessionWindows()
+	if renew != 30*time.Minute || warn != defaultWarnWithin {
+		t.Error("expected a 30m renewal window and the default warning window, got", renew, warn)
+	}
+}
+
+func TestConfigExpiresIn(t *testing.T) {
+	c := Config{ConfigSession: ConfigSession{ExpiresAt: currentTimeMillis() + 120000}}
+	if in := c.ExpiresIn(); in <= time.Minute || in > 2*time.Minute {
+		t.Error("expected the session to expire in about 2 minutes, got", in)
+	}
+}
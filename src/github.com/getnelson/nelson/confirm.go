@@ -0,0 +1,97 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	errNoTerminal   = errors.New("Refusing to continue without confirmation as there is no terminal to ask on; pass --yes to proceed.")
+	errNotConfirmed = errors.New("Aborted.")
+)
+
+// swapped out in tests
+var (
+	confirmInput    io.Reader = os.Stdin
+	confirmOutput   io.Writer = os.Stderr
+	stdinIsTerminal           = func() bool { return isatty.IsTerminal(os.Stdin.Fd()) }
+)
+
+// the flag every destructive command takes to skip its confirmation
+func yesFlag(destination *bool) cli.BoolFlag {
+	return cli.BoolFlag{
+		Name:        "yes, y",
+		Usage:       "Do not ask for confirmation",
+		Destination: destination,
+	}
+}
+
+// Confirm asks the user to approve a destructive action before it is
+// taken. describe fetches the resource the action applies to, so that the
+// user sees what a GUID actually refers to; each row is a label and a
+// value. Nothing is asked or fetched when assumeYes is set or on a dry
+// run, and without a terminal the action is refused.
+func Confirm(action string, assumeYes bool, describe func() ([][]string, error)) error {
+	if assumeYes || globalDryRun {
+		return nil
+	}
+	if !stdinIsTerminal() {
+		return errNoTerminal
+	}
+	details, err := describe()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(confirmOutput, "===>> About to "+action)
+	width := 0
+	for _, d := range details {
+		if len(d[0])+1 > width {
+			width = len(d[0]) + 1
+		}
+	}
+	for _, d := range details {
+		fmt.Fprintf(confirmOutput, "  %-*s  %s\n", width, d[0]+":", d[1])
+	}
+	fmt.Fprint(confirmOutput, "Continue? [y/N] ")
+
+	answer, _ := bufio.NewReader(confirmInput).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errNotConfirmed
+}
+
+// turns an error from Confirm into the command's exit error; what names
+// the resource that could not be looked up.
+func confirmationExit(err error, what string) error {
+	if err == errNoTerminal || err == errNotConfirmed {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	PrintTerminalError(err)
+	return cli.NewExitError("Unable to look up "+what+".", 1)
+}
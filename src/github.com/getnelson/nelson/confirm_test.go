@@ -0,0 +1,82 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func withConfirmTerminal(t *testing.T, terminal bool, answer string) *bytes.Buffer {
+	var out bytes.Buffer
+	in, outWas, ttyWas := confirmInput, confirmOutput, stdinIsTerminal
+	confirmInput = strings.NewReader(answer)
+	confirmOutput = &out
+	stdinIsTerminal = func() bool { return terminal }
+	t.Cleanup(func() {
+		confirmInput, confirmOutput, stdinIsTerminal = in, outWas, ttyWas
+	})
+	return &out
+}
+
+func describeFixture() ([][]string, error) {
+	return [][]string{{"GUID", "04dsq452xvq"}, {"Namespace", "prod"}}, nil
+}
+
+func TestConfirmAccepts(t *testing.T) {
+	out := withConfirmTerminal(t, true, "y\n")
+	if err := Confirm("remove load balancer 04dsq452xvq", false, describeFixture); err != nil {
+		t.Errorf("expected confirmation, got %v", err)
+	}
+	if !strings.Contains(out.String(), "Namespace:  prod") {
+		t.Errorf("expected the prompt to describe the resource, got:\n%s", out.String())
+	}
+}
+
+func TestConfirmDeclines(t *testing.T) {
+	for _, answer := range []string{"\n", "n\n", "nope\n", ""} {
+		withConfirmTerminal(t, true, answer)
+		if err := Confirm("remove", false, describeFixture); err != errNotConfirmed {
+			t.Errorf("expected answer %q to decline, got %v", answer, err)
+		}
+	}
+}
+
+func TestConfirmWithoutTerminal(t *testing.T) {
+	withConfirmTerminal(t, false, "y\n")
+	described := false
+	err := Confirm("remove", false, func() ([][]string, error) {
+		described = true
+		return nil, nil
+	})
+	if err != errNoTerminal || described {
+		t.Errorf("expected to refuse without looking anything up, got %v", err)
+	}
+	if err := Confirm("remove", true, describeFixture); err != nil {
+		t.Errorf("expected --yes to skip the prompt, got %v", err)
+	}
+}
+
+func TestConfirmLookupFailure(t *testing.T) {
+	withConfirmTerminal(t, true, "y\n")
+	lookup := errors.New("not found")
+	if err := Confirm("remove", false, func() ([][]string, error) { return nil, lookup }); err != lookup {
+		t.Errorf("expected the lookup error, got %v", err)
+	}
+}
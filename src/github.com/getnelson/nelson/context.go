@@ -0,0 +1,86 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+///////////////////////////// CLI ENTRYPOINT ////////////////////////////////
+
+// reads the config file and applies the given modification to it,
+// only writing the file back if the modification succeeded.
+func ModifyContexts(modify func(*ConfigFile) error) error {
+	pth := defaultConfigPath()
+	if _, err := os.Stat(pth); os.IsNotExist(err) {
+		return errors.New("No config file existed at " + pth + ". You need to `nelson login` before managing contexts.")
+	}
+	return updateConfigFile(pth, modify)
+}
+
+/*
+ * {
+ *   "name": "staging",
+ *   "endpoint": "https://nelson.staging.yourcompany.com",
+ *   "current": true,
+ *   "expires_at": 1469928212871
+ * }
+ */
+type ContextSummary struct {
+	Name      string `json:"name"`
+	Endpoint  string `json:"endpoint"`
+	Current   bool   `json:"current"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// deliberately omits the session token, so that listing contexts
+// never writes credentials to stdout.
+func SummarizeContexts(f *ConfigFile) []ContextSummary {
+	out := []ContextSummary{}
+	for _, c := range f.Contexts {
+		out = append(out, ContextSummary{
+			Name:      c.Name,
+			Endpoint:  c.Endpoint,
+			Current:   c.Name == f.CurrentContext,
+			ExpiresAt: c.ExpiresAt,
+		})
+	}
+	return out
+}
+
+var contextColumns = []Column{
+	{Name: "current", Header: "Current", Value: func(r interface{}) string {
+		if r.(ContextSummary).Current {
+			return "*"
+		}
+		return ""
+	}},
+	{Name: "name", Header: "Name", Value: func(r interface{}) string { return r.(ContextSummary).Name }},
+	{Name: "endpoint", Header: "Endpoint", Value: func(r interface{}) string { return r.(ContextSummary).Endpoint }},
+	{Name: "expires_at", Header: "Session Expires", Value: func(r interface{}) string {
+		c := r.(ContextSummary)
+		if c.ExpiresAt > currentTimeMillis() {
+			return javaEpochToHumanizedTime(c.ExpiresAt)
+		}
+		return "expired"
+	}},
+}
+
+func PrintListContexts(contexts []ContextSummary) {
+	RenderList(contexts, contextColumns)
+}
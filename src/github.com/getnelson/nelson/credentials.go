@@ -0,0 +1,315 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CredentialStore keeps the session token of each context. By default
+// tokens live in the config file itself; the other stores keep them out
+// of it, leaving only the endpoint and expiry behind.
+type CredentialStore interface {
+	// Get returns the token of the named context, or "" if there is none.
+	Get(context string) (string, error)
+	Set(context string, token string) error
+	Delete(context string) error
+}
+
+const (
+	CredentialStoreFile          = "file"
+	CredentialStoreEncryptedFile = "encrypted-file"
+	CredentialStoreHelper        = "helper"
+)
+
+// the store selected by the config file's credential_store setting.
+func (f *ConfigFile) credentialStore() (CredentialStore, error) {
+	switch f.CredentialStore {
+	case "", CredentialStoreFile:
+		return plainStore{file: f}, nil
+	case CredentialStoreEncryptedFile:
+		return encryptedStore{path: filepath.Join(filepath.Dir(defaultConfigPath()), "credentials.enc")}, nil
+	case CredentialStoreHelper:
+		if len(f.CredentialHelper) == 0 {
+			return nil, errors.New("credential_store is 'helper' but no credential_helper command is configured.")
+		}
+		return helperStore{command: f.CredentialHelper}, nil
+	}
+	return nil, errors.New("Unknown credential_store '" + f.CredentialStore + "'; must be one of file, encrypted-file or helper.")
+}
+
+// moves the token of a renamed context.
+func renameCredential(store CredentialStore, from string, to string) error {
+	token, err := store.Get(from)
+	if err != nil || len(token) == 0 {
+		return err
+	}
+	if err := store.Set(to, token); err != nil {
+		return err
+	}
+	return store.Delete(from)
+}
+
+/////////////////// PLAIN FILE ///////////////////
+
+// keeps tokens in the session block of the config file, as the cli
+// always has. Changes are saved along with the rest of the file.
+type plainStore struct {
+	file *ConfigFile
+}
+
+func (s plainStore) Get(context string) (string, error) {
+	if i := s.file.indexOfContext(context); i >= 0 {
+		return s.file.Contexts[i].Token, nil
+	}
+	return "", nil
+}
+
+func (s plainStore) Set(context string, token string) error {
+	if i := s.file.indexOfContext(context); i >= 0 {
+		s.file.Contexts[i].Token = token
+	}
+	return nil
+}
+
+func (s plainStore) Delete(context string) error {
+	return s.Set(context, "")
+}
+
+/////////////////// ENCRYPTED FILE ///////////////////
+
+const (
+	credentialsPassphraseEnv = "NELSON_CREDENTIALS_PASSPHRASE"
+	pbkdf2Iterations         = 100000
+)
+
+// keeps tokens in a separate file, encrypted with AES-GCM under a key
+// derived from the passphrase in $NELSON_CREDENTIALS_PASSPHRASE.
+type encryptedStore struct {
+	path string
+}
+
+/*
+ * {
+ *   "salt": "base64...",
+ *   "nonce": "base64...",
+ *   "data": "base64..."
+ * }
+ */
+type encryptedCredentials struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+func (s encryptedStore) passphrase() ([]byte, error) {
+	p := os.Getenv(credentialsPassphraseEnv)
+	if len(p) == 0 {
+		return nil, errors.New("The encrypted-file credential store needs a passphrase in $" + credentialsPassphraseEnv + ".")
+	}
+	return []byte(p), nil
+}
+
+func (s encryptedStore) read() (map[string]string, error) {
+	tokens := map[string]string{}
+	raw, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pass, err := s.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	var enc encryptedCredentials
+	if err := json.Unmarshal(raw, &enc); err != nil {
+		return nil, errors.New("Unable to read " + s.path + ": " + err.Error())
+	}
+	gcm, err := newCredentialsCipher(pass, enc.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, enc.Nonce, enc.Data, nil)
+	if err != nil {
+		return nil, errors.New("Unable to decrypt " + s.path + "; is $" + credentialsPassphraseEnv + " correct?")
+	}
+	if err := json.Unmarshal(plain, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s encryptedStore) write(tokens map[string]string) error {
+	pass, err := s.passphrase()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	enc := encryptedCredentials{Salt: make([]byte, 16)}
+	if _, err := rand.Read(enc.Salt); err != nil {
+		return err
+	}
+	gcm, err := newCredentialsCipher(pass, enc.Salt)
+	if err != nil {
+		return err
+	}
+	enc.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(enc.Nonce); err != nil {
+		return err
+	}
+	enc.Data = gcm.Seal(nil, enc.Nonce, plain, nil)
+	out, err := json.Marshal(enc)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, out, 0600)
+}
+
+func (s encryptedStore) Get(context string) (string, error) {
+	tokens, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	return tokens[context], nil
+}
+
+func (s encryptedStore) Set(context string, token string) error {
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+	tokens[context] = token
+	return s.write(tokens)
+}
+
+func (s encryptedStore) Delete(context string) error {
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := tokens[context]; !ok {
+		return nil
+	}
+	delete(tokens, context)
+	return s.write(tokens)
+}
+
+func newCredentialsCipher(passphrase []byte, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2SHA256(passphrase, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// PBKDF2 (RFC 8018) with HMAC-SHA256.
+func pbkdf2SHA256(password []byte, salt []byte, iterations int, keyLen int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, string(password), salt, iterations, keyLen)
+}
+
+/////////////////// CREDENTIAL HELPER ///////////////////
+
+// delegates to an external command speaking the docker credential
+// helper protocol (e.g. docker-credential-osxkeychain or
+// docker-credential-pass), so tokens can live in the os keychain.
+// Each context is stored under the server url nelson://<context>.
+type helperStore struct {
+	command string
+}
+
+/*
+ * {
+ *   "ServerURL": "nelson://staging",
+ *   "Username": "nelson",
+ *   "Secret": "xxx"
+ * }
+ */
+type helperCredentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+func helperServerURL(context string) string {
+	return "nelson://" + context
+}
+
+func (s helperStore) run(action string, input []byte) ([]byte, error) {
+	cmd := exec.Command(s.command, action)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stdout.String() + " " + stderr.String())
+		return nil, errors.New("Credential helper '" + s.command + " " + action + "' failed: " + err.Error() + " " + msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+func (s helperStore) Get(context string) (string, error) {
+	out, err := s.run("get", []byte(helperServerURL(context)))
+	if err != nil {
+		if strings.Contains(err.Error(), "credentials not found") {
+			return "", nil
+		}
+		return "", err
+	}
+	var creds helperCredentials
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", errors.New("Credential helper '" + s.command + "' returned an unreadable answer: " + err.Error())
+	}
+	return creds.Secret, nil
+}
+
+func (s helperStore) Set(context string, token string) error {
+	in, err := json.Marshal(helperCredentials{ServerURL: helperServerURL(context), Username: "nelson", Secret: token})
+	if err != nil {
+		return err
+	}
+	_, err = s.run("store", in)
+	return err
+}
+
+func (s helperStore) Delete(context string) error {
+	_, err := s.run("erase", []byte(helperServerURL(context)))
+	if err != nil && strings.Contains(err.Error(), "credentials not found") {
+		return nil
+	}
+	return err
+}
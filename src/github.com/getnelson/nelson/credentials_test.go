@@ -0,0 +1,194 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEncryptedStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	t.Setenv(credentialsPassphraseEnv, "correct horse")
+	if err := (encryptedStore{path: path}).Set("staging", "s3cr3t-token"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a fresh store has nothing but the file and the passphrase to go on
+	if token, err := (encryptedStore{path: path}).Get("staging"); err != nil || token != "s3cr3t-token" {
+		t.Fatalf("expected s3cr3t-token, got %q (%v)", token, err)
+	}
+
+	t.Setenv(credentialsPassphraseEnv, "battery staple")
+	if token, err := (encryptedStore{path: path}).Get("staging"); err == nil {
+		t.Errorf("expected the wrong passphrase to fail, got %q", token)
+	}
+
+	t.Setenv(credentialsPassphraseEnv, "correct horse")
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var enc encryptedCredentials
+	if err := json.Unmarshal(raw, &enc); err != nil {
+		t.Fatal(err)
+	}
+	enc.Data[len(enc.Data)/2] ^= 0xff
+	tampered, _ := json.Marshal(enc)
+	if err := ioutil.WriteFile(path, tampered, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := (encryptedStore{path: path}).Get("staging"); err == nil {
+		t.Errorf("expected the tampered file to fail, got %q", token)
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	store := encryptedStore{path: path}
+
+	t.Setenv(credentialsPassphraseEnv, "")
+	if err := store.Set("staging", "abc"); err == nil {
+		t.Error("expected the store to require a passphrase")
+	}
+
+	t.Setenv(credentialsPassphraseEnv, "hunter2")
+	if err := store.Set("staging", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("prod", "def"); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(raw), "abc") {
+		t.Error("expected the token not to be stored in plaintext")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 600, got %o", info.Mode().Perm())
+	}
+	if token, err := store.Get("staging"); err != nil || token != "abc" {
+		t.Errorf("expected abc, got %q (%v)", token, err)
+	}
+	if err := store.Delete("staging"); err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := store.Get("staging"); token != "" {
+		t.Errorf("expected the token to be deleted, got %q", token)
+	}
+
+	t.Setenv(credentialsPassphraseEnv, "wrong")
+	if _, err := store.Get("prod"); err == nil {
+		t.Error("expected the wrong passphrase to fail")
+	}
+}
+
+// a credential helper that keeps a single secret in a file
+const fakeCredentialHelper = `#!/bin/sh
+store="$(dirname "$0")/secret"
+case "$1" in
+  store) cat > "$store" ;;
+  get) [ -f "$store" ] && cat "$store" || { echo "credentials not found in native keychain"; exit 1; } ;;
+  erase) rm -f "$store" ;;
+esac
+`
+
+func TestHelperStore(t *testing.T) {
+	helper := filepath.Join(t.TempDir(), "docker-credential-fake")
+	if err := ioutil.WriteFile(helper, []byte(fakeCredentialHelper), 0700); err != nil {
+		t.Fatal(err)
+	}
+	store := helperStore{command: helper}
+
+	if token, err := store.Get("staging"); err != nil || token != "" {
+		t.Errorf("expected no token, got %q (%v)", token, err)
+	}
+	if err := store.Set("staging", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := store.Get("staging"); err != nil || token != "abc" {
+		t.Errorf("expected abc, got %q (%v)", token, err)
+	}
+	if err := store.Delete("staging"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfigFromCredentialStore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(credentialsPassphraseEnv, "hunter2")
+	path := defaultConfigPath()
+
+	err := updateConfigFile(path, func(f *ConfigFile) error {
+		f.CredentialStore = CredentialStoreEncryptedFile
+		f.SetContext("staging", Config{Endpoint: "https://nelson", ConfigSession: ConfigSession{ExpiresAt: 1}})
+		store, err := f.credentialStore()
+		if err != nil {
+			return err
+		}
+		return store.Set("staging", "abc")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(raw), "abc") {
+		t.Error("expected the token to be kept out of the config file")
+	}
+	_, file := readConfigFile(path)
+	cfg, err := file.loadConfig("staging")
+	if err != nil || cfg.Token != "abc" || cfg.contextName != "staging" {
+		t.Errorf("expected the token to be loaded from the store, got %+v (%v)", cfg, err)
+	}
+}
+
+func TestConcurrentConfigUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			updateConfigFile(path, func(f *ConfigFile) error {
+				f.SetContext(name, Config{Endpoint: "https://" + name})
+				return nil
+			})
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+
+	_, file := readConfigFile(path)
+	if len(file.Contexts) != 20 {
+		t.Errorf("expected every update to survive, got %d contexts", len(file.Contexts))
+	}
+}
+
+func TestRestrictConfigPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	ioutil.WriteFile(path, []byte("---\n"), 0755)
+	os.Chmod(path, 0755)
+
+	restrictConfigPermissions(path)
+	if info, _ := os.Stat(path); info.Mode().Perm() != configFileMode {
+		t.Errorf("expected mode %o, got %o", configFileMode, info.Mode().Perm())
+	}
+}
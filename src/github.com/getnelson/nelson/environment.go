@@ -0,0 +1,83 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+)
+
+// where the config of an invocation came from; see LoadDefaultConfigOrExit.
+const (
+	configSourceFlag         = "flag"          // the context named by --context
+	configSourceSessionToken = "session-token" // NELSON_ADDR and NELSON_SESSION_TOKEN
+	configSourceFile         = "file"          // the current context of the config file
+	configSourceGithubToken  = "github-token"  // NELSON_ADDR and GITHUB_TOKEN
+)
+
+// the endpoint named by NELSON_ADDR. A bare host is assumed to be
+// https, as it is for `nelson login`.
+func endpointFromEnvironment() string {
+	addr := strings.TrimSpace(os.Getenv("NELSON_ADDR"))
+	if len(addr) == 0 || strings.Contains(addr, "://") {
+		return strings.TrimSuffix(addr, "/")
+	}
+	return createEndpointURL(addr, true)
+}
+
+// a config for an existing session handed over in the environment, or
+// nil when there is none. The expiry of such a session is not known.
+func sessionFromEnvironment() *Config {
+	endpoint := endpointFromEnvironment()
+	token := os.Getenv("NELSON_SESSION_TOKEN")
+	if len(endpoint) == 0 || len(token) == 0 {
+		return nil
+	}
+	return &Config{
+		Endpoint:      endpoint,
+		ConfigSession: ConfigSession{Token: token},
+		source:        configSourceSessionToken,
+	}
+}
+
+func canLoginFromEnvironment() bool {
+	return len(endpointFromEnvironment()) > 0 && canRenewSession()
+}
+
+// exchanges GITHUB_TOKEN for a session with the endpoint of target,
+// keeping it in memory only: nothing is written to the config file.
+func createSessionInMemory(ctx context.Context, target *Config) (*Config, error) {
+	if !canRenewSession() {
+		return nil, errors.New("Environment GITHUB_TOKEN variable not defined, so no session can be created.")
+	}
+	c := NewClient(&Config{Endpoint: target.Endpoint, TLS: target.TLS, Proxy: target.Proxy})
+	c.DryRun = false // as for Login
+	sess, err := c.CreateSession(ctx, os.Getenv("GITHUB_TOKEN"))
+	if err != nil {
+		return nil, err
+	}
+	cfg := *target
+	cfg.ConfigSession = ConfigSession{Token: sess.SessionToken, ExpiresAt: sess.ExpiresAt}
+	cfg.source = configSourceGithubToken
+	return &cfg, nil
+}
+
+func (c *Config) fromEnvironment() bool {
+	return c.source == configSourceSessionToken || c.source == configSourceGithubToken
+}
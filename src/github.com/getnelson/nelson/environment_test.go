@@ -0,0 +1,87 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestSessionTokenFromEnvironment(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("NELSON_ADDR", "nelson.example.com")
+	t.Setenv("NELSON_SESSION_TOKEN", "abc")
+
+	cfg := LoadDefaultConfigOrExit()
+	if cfg.Endpoint != "https://nelson.example.com" || cfg.Token != "abc" || cfg.source != configSourceSessionToken {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if _, err := os.Stat(os.Getenv("HOME") + "/.nelson"); !os.IsNotExist(err) {
+		t.Error("expected nothing to be written to disk")
+	}
+}
+
+func TestGithubTokenFromEnvironment(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"session_token": "fresh", "expires_at": 4102444800000}`))
+	}))
+	defer server.Close()
+	t.Setenv("NELSON_ADDR", server.URL)
+	t.Setenv("GITHUB_TOKEN", "gh")
+
+	cfg := LoadDefaultConfigOrExit()
+	if cfg.Endpoint != server.URL || cfg.Token != "fresh" || cfg.source != configSourceGithubToken {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if _, err := os.Stat(os.Getenv("HOME") + "/.nelson"); !os.IsNotExist(err) {
+		t.Error("expected nothing to be written to disk")
+	}
+}
+
+func TestConfigSourcePrecedence(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	file := &ConfigFile{}
+	session := ConfigSession{Token: "from-file", ExpiresAt: 4102444800000}
+	file.SetContext("staging", Config{Endpoint: "https://staging.example.com", ConfigSession: session})
+	file.SetContext("prod", Config{Endpoint: "https://prod.example.com", ConfigSession: session})
+	if err := writeConfigFile(file, defaultConfigPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the config file beats GITHUB_TOKEN
+	t.Setenv("NELSON_ADDR", "nelson.example.com")
+	t.Setenv("GITHUB_TOKEN", "gh")
+	if cfg := LoadDefaultConfigOrExit(); cfg.source != configSourceFile || cfg.contextName != "staging" {
+		t.Errorf("expected the current context, got %+v", cfg)
+	}
+
+	// NELSON_SESSION_TOKEN beats the config file
+	t.Setenv("NELSON_SESSION_TOKEN", "abc")
+	if cfg := LoadDefaultConfigOrExit(); cfg.source != configSourceSessionToken {
+		t.Errorf("expected the session from the environment, got %+v", cfg)
+	}
+
+	// and --context beats them all
+	globalContext = "prod"
+	defer func() { globalContext = "" }()
+	if cfg := LoadDefaultConfigOrExit(); cfg.source != configSourceFlag || cfg.Endpoint != "https://prod.example.com" {
+		t.Errorf("expected the context named by the flag, got %+v", cfg)
+	}
+}
@@ -0,0 +1,136 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+)
+
+/*
+ * {
+ *   "unit": "howdy-http",
+ *   "namespace": "dev",
+ *   "guid": "b8ff485a0306",
+ *   "stack_name": "howdy-http--1-2-3--b8ff485a",
+ *   "status": "ready",
+ *   "expires_at": 1467225866870,
+ *   "expires_in_seconds": 86400
+ * }
+ */
+type ExpiringStack struct {
+	Unit             string `json:"unit"`
+	Namespace        string `json:"namespace"`
+	Guid             string `json:"guid"`
+	StackName        string `json:"stack_name"`
+	Status           string `json:"status"`
+	ExpiresAt        int64  `json:"expires_at"`
+	ExpiresInSeconds int64  `json:"expires_in_seconds"`
+}
+
+// FindExpiringStacks inspects every stack stacks list would show for the
+// given datacenters, namespaces and unit, at most concurrency at a time,
+// and returns those that have yet to expire but will within the window,
+// grouped by unit and namespace and soonest first within each group.
+func FindExpiringStacks(ctx context.Context, c *client.Client, datacenters string, namespaces string, unit string, within time.Duration, concurrency int) ([]ExpiringStack, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	stacks, err := c.ListStacks(ctx, datacenters, namespaces, "", unit)
+	if err != nil {
+		return nil, err
+	}
+
+	now := currentTimeMillis()
+	cutoff := now + int64(within/time.Millisecond)
+	out := []ExpiringStack{}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, concurrency)
+	for _, s := range stacks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(s client.Stack) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			summary, err := c.InspectStack(ctx, s.Guid)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			// stacks that never expire report no expiration at all
+			if summary.Expiration <= now || summary.Expiration > cutoff {
+				return
+			}
+			out = append(out, ExpiringStack{
+				Unit:             s.UnitName,
+				Namespace:        s.NamespaceRef,
+				Guid:             s.Guid,
+				StackName:        s.StackName,
+				Status:           s.Status,
+				ExpiresAt:        summary.Expiration,
+				ExpiresInSeconds: (summary.Expiration - now) / 1000,
+			})
+		}(s)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Unit != out[j].Unit {
+			return out[i].Unit < out[j].Unit
+		}
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		return out[i].ExpiresAt < out[j].ExpiresAt
+	})
+	return out, nil
+}
+
+var expiringColumns = []Column{
+	{Name: "unit", Header: "Unit", Value: func(r interface{}) string { return r.(ExpiringStack).Unit }},
+	{Name: "namespace", Header: "Namespace", Value: func(r interface{}) string { return r.(ExpiringStack).Namespace }},
+	{Name: "guid", Header: "GUID", Value: func(r interface{}) string { return r.(ExpiringStack).Guid }},
+	{Name: "stack_name", Header: "Stack", Value: func(r interface{}) string { return truncateString(r.(ExpiringStack).StackName, 55) }},
+	{Name: "status", Header: "Status", Value: func(r interface{}) string { return r.(ExpiringStack).Status }},
+	{Name: "expires_at", Header: "Expires", Value: func(r interface{}) string { return javaEpochToHumanizedTime(r.(ExpiringStack).ExpiresAt) }},
+	{Name: "expires_in_seconds", Header: "Seconds Left", Value: func(r interface{}) string { return strconv.FormatInt(r.(ExpiringStack).ExpiresInSeconds, 10) }, Optional: true},
+}
+
+func PrintExpiringStacks(stacks []ExpiringStack, within time.Duration) {
+	if len(stacks) == 0 && len(globalFormat) == 0 {
+		fmt.Println("===>> No stacks expire within " + within.String())
+		return
+	}
+	RenderList(stacks, expiringColumns)
+}
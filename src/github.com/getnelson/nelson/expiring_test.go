@@ -0,0 +1,80 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+)
+
+func TestFindExpiringStacks(t *testing.T) {
+	now := currentTimeMillis()
+	expirations := map[string]int64{
+		"aaaaaaaaaaaa": now + int64(time.Hour/time.Millisecond),
+		"bbbbbbbbbbbb": now + int64(72*time.Hour/time.Millisecond),
+		"cccccccccccc": now - int64(time.Minute/time.Millisecond),
+		"dddddddddddd": 0,
+		"eeeeeeeeeeee": now + int64(2*time.Hour/time.Millisecond),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/deployments" {
+			w.Write([]byte(`[
+				{"guid": "aaaaaaaaaaaa", "unit": "howdy", "namespace": "dev"},
+				{"guid": "bbbbbbbbbbbb", "unit": "howdy", "namespace": "dev"},
+				{"guid": "cccccccccccc", "unit": "howdy", "namespace": "dev"},
+				{"guid": "dddddddddddd", "unit": "howdy", "namespace": "dev"},
+				{"guid": "eeeeeeeeeeee", "unit": "aloha", "namespace": "qa"}
+			]`))
+			return
+		}
+		guid := strings.TrimPrefix(r.URL.Path, "/v1/deployments/")
+		fmt.Fprintf(w, `{"guid": %q, "expiration": %d}`, guid, expirations[guid])
+	}))
+	defer server.Close()
+
+	stacks, err := FindExpiringStacks(context.Background(), client.New(server.URL, client.Session{}), "", "", "", 48*time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guids := []string{}
+	for _, s := range stacks {
+		guids = append(guids, s.Unit+"/"+s.Namespace+"/"+s.Guid)
+	}
+	// cccc has already expired, bbbb expires after the window and dddd never does
+	if strings.Join(guids, ",") != "aloha/qa/eeeeeeeeeeee,howdy/dev/aaaaaaaaaaaa" {
+		t.Errorf("expected stacks grouped by unit and namespace, got %v", guids)
+	}
+	if stacks[1].ExpiresInSeconds <= 0 || stacks[1].ExpiresInSeconds > 3600 {
+		t.Errorf("unexpected countdown %+v", stacks[1])
+	}
+
+	var out bytes.Buffer
+	if err := renderList(&out, stacks, expiringColumns, "", "guid,namespace", false); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Fields(out.String()); strings.Join(lines, " ") != "eeeeeeeeeeee qa aaaaaaaaaaaa dev" {
+		t.Errorf("expected --columns to apply, got %q", out.String())
+	}
+}
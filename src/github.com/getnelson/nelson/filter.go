@@ -0,0 +1,366 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// set by --filter, --sort-by, --reverse and --limit; see RenderRows.
+var globalFilter string
+var globalSortBy string
+var globalReverse bool
+var globalLimit int
+
+// RenderRows is Render for list commands. rows is a pointer to the slice
+// being listed, which is filtered, sorted and limited in place before it
+// is rendered, so table and structured output both see the same rows.
+func RenderRows(rows interface{}, table func()) {
+	if err := applyListOptions(rows, globalFilter, globalSortBy, globalReverse, globalLimit); err != nil {
+		PrintTerminalErrors([]error{err})
+		os.Exit(1)
+	}
+	Render(reflect.ValueOf(rows).Elem().Interface(), table)
+}
+
+func applyListOptions(rows interface{}, filter string, sortBy string, reverse bool, limit int) error {
+	slice := reflect.ValueOf(rows).Elem()
+	fields := map[string]reflect.Type{}
+	jsonFields(slice.Type().Elem(), "", fields)
+
+	f, err := parseFilter(filter)
+	if err != nil {
+		return err
+	}
+	for _, all := range f {
+		for i, c := range all {
+			t, ok := fields[c.field]
+			if !ok {
+				return unknownFieldError(c.field, fields)
+			}
+			all[i].numeric = isNumericKind(t.Kind())
+		}
+	}
+	if _, ok := fields[sortBy]; len(sortBy) > 0 && !ok {
+		return unknownFieldError(sortBy, fields)
+	}
+
+	type row struct {
+		value  reflect.Value
+		fields map[string]interface{}
+	}
+	kept := []row{}
+	for i := 0; i < slice.Len(); i++ {
+		r := row{value: slice.Index(i)}
+		if r.fields, err = fieldValues(r.value.Interface()); err != nil {
+			return err
+		}
+		if f.matches(r.fields) {
+			kept = append(kept, r)
+		}
+	}
+
+	if len(sortBy) > 0 {
+		numeric := isNumericKind(fields[sortBy].Kind())
+		key := func(r row) interface{} {
+			v := lookupField(r.fields, sortBy)
+			if v == nil && numeric {
+				return float64(0)
+			}
+			return v
+		}
+		sort.SliceStable(kept, func(i, j int) bool {
+			return compareValues(key(kept[i]), key(kept[j])) < 0
+		})
+	}
+	if reverse {
+		for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+			kept[i], kept[j] = kept[j], kept[i]
+		}
+	}
+	if limit > 0 && len(kept) > limit {
+		kept = kept[:limit]
+	}
+
+	out := reflect.MakeSlice(slice.Type(), 0, len(kept))
+	for _, r := range kept {
+		out = reflect.Append(out, r.value)
+	}
+	slice.Set(out)
+	return nil
+}
+
+func unknownFieldError(field string, fields map[string]reflect.Type) error {
+	names := []string{}
+	for f := range fields {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	return errors.New("Unknown field '" + field + "'; the available fields are " + strings.Join(names, ", "))
+}
+
+/////////////////////////////// FIELDS ///////////////////////////////////
+
+// the json field names of a type and their types, with those of nested
+// structs given as dotted paths such as version.major; these are what
+// filters refer to.
+func jsonFields(t reflect.Type, prefix string, out map[string]reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if len(f.PkgPath) > 0 || name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		out[prefix+name] = f.Type
+		jsonFields(f.Type, prefix+name+".", out)
+	}
+}
+
+// the row as its json fields, so that filters see the same names and
+// values as --output json does.
+func fieldValues(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{}
+	return out, json.Unmarshal(b, &out)
+}
+
+// nil when the field is absent, as fields left out by omitempty are.
+func lookupField(fields map[string]interface{}, path string) interface{} {
+	var v interface{} = fields
+	for _, p := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+// numbers compare numerically, everything else by its string form.
+func compareValues(a interface{}, b interface{}) int {
+	x, xok := a.(float64)
+	y, yok := b.(float64)
+	if xok && yok {
+		return compareFloats(x, y)
+	}
+	return strings.Compare(formatFieldValue(a), formatFieldValue(b))
+}
+
+func compareFloats(x float64, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func formatFieldValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// nelson reports times as epoch millis, in fields such as deployed_at
+// and deploy_time.
+func isTimeField(field string) bool {
+	return strings.HasSuffix(field, "_at") || strings.HasSuffix(field, "_time")
+}
+
+/////////////////////////////// FILTERS //////////////////////////////////
+
+/*
+ * filter  = all { "||" all }
+ * all     = clause { "&&" clause }
+ * clause  = field op value
+ * op      = "=" | "!=" | ">" | ">=" | "<" | "<=" | "~"
+ *
+ * e.g. plan=canary && workflow!=manual && deployed_at>7d
+ */
+type listFilter [][]filterClause
+
+type filterClause struct {
+	field   string
+	op      string
+	value   string
+	pattern *regexp.Regexp // for ~
+	numeric bool           // a number field, which is zero when omitted
+}
+
+var clausePattern = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_.]*)\s*(!=|>=|<=|=|>|<|~)\s*(.*?)\s*$`)
+
+func parseFilter(expr string) (listFilter, error) {
+	f := listFilter{}
+	if len(strings.TrimSpace(expr)) == 0 {
+		return f, nil
+	}
+	for _, alternative := range strings.Split(expr, "||") {
+		all := []filterClause{}
+		for _, s := range strings.Split(alternative, "&&") {
+			m := clausePattern.FindStringSubmatch(s)
+			if m == nil {
+				return nil, errors.New("Invalid --filter clause '" + strings.TrimSpace(s) + "'; expected <field><op><value>, e.g. status=ready")
+			}
+			c := filterClause{field: m[1], op: m[2], value: unquote(m[3])}
+			if c.op == "~" {
+				p, err := regexp.Compile(c.value)
+				if err != nil {
+					return nil, errors.New("Invalid --filter pattern '" + c.value + "': " + err.Error())
+				}
+				c.pattern = p
+			}
+			all = append(all, c)
+		}
+		f = append(f, all)
+	}
+	return f, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func (f listFilter) matches(fields map[string]interface{}) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, all := range f {
+		ok := true
+		for _, c := range all {
+			ok = ok && c.matches(lookupField(fields, c.field))
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c filterClause) matches(actual interface{}) bool {
+	if c.op == "~" {
+		return c.pattern.MatchString(formatFieldValue(actual))
+	}
+	cmp := c.compare(actual)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+var agePattern = regexp.MustCompile(`^(\d+)([smhdw])$`)
+
+// compares the field with the value of the clause. Against a time field
+// a duration such as 7d compares the age of the field, so deployed_at>7d
+// means deployed more than seven days ago, and a date such as 2017-06-01
+// (or an RFC 3339 time) compares the time itself.
+func (c filterClause) compare(actual interface{}) int {
+	if actual == nil && c.numeric {
+		actual = float64(0)
+	}
+	if n, ok := actual.(float64); ok {
+		if isTimeField(c.field) {
+			if age, ok := parseAge(c.value); ok {
+				return compareFloats(float64(currentTimeMillis())-n, float64(age/time.Millisecond))
+			}
+			if t, ok := parseDate(c.value); ok {
+				return compareFloats(n, float64(t.UnixNano()/int64(time.Millisecond)))
+			}
+		}
+		if want, err := strconv.ParseFloat(c.value, 64); err == nil {
+			return compareFloats(n, want)
+		}
+	}
+	return strings.Compare(formatFieldValue(actual), c.value)
+}
+
+func parseAge(s string) (time.Duration, bool) {
+	m := agePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	n, _ := strconv.Atoi(m[1])
+	unit := map[string]time.Duration{
+		"s": time.Second,
+		"m": time.Minute,
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}[m[2]]
+	return time.Duration(n) * unit, true
+}
+
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
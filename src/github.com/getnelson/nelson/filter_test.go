@@ -0,0 +1,112 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+)
+
+func filterTestStacks() []client.Stack {
+	day := int64(24 * time.Hour / time.Millisecond)
+	now := currentTimeMillis()
+	return []client.Stack{
+		{Guid: "aaa", Plan: "canary", Workflow: "magnetar", Status: "ready", DeployedAt: now - 10*day},
+		{Guid: "bbb", Plan: "canary", Workflow: "manual", Status: "ready", DeployedAt: now - 9*day},
+		{Guid: "ccc", Plan: "default", Workflow: "magnetar", Status: "deploying", DeployedAt: now - 1*day},
+		{Guid: "ddd", Plan: "canary", Workflow: "magnetar", Status: "failed", DeployedAt: now - 8*day},
+	}
+}
+
+func guidsOf(stacks []client.Stack) string {
+	guids := []string{}
+	for _, s := range stacks {
+		guids = append(guids, s.Guid)
+	}
+	return strings.Join(guids, ",")
+}
+
+func TestFilterExpressions(t *testing.T) {
+	cases := map[string]string{
+		"": "aaa,bbb,ccc,ddd",
+		"plan=canary && workflow!=manual && deployed_at>7d": "aaa,ddd",
+		"deployed_at<2d":                                 "ccc",
+		"status=failed || status = deploying":            "ccc,ddd",
+		"guid~^[ab]":                                     "aaa,bbb",
+		"status='ready' && guid>=bbb":                    "bbb",
+		"deployed_at>" + time.Now().Format("2006-01-02"): "",
+		"deployed_at>" + time.Now().AddDate(0, 0, -30).Format(time.RFC3339): "aaa,bbb,ccc,ddd",
+		"weight=0": "aaa,bbb,ccc,ddd",
+	}
+	for expr, want := range cases {
+		stacks := filterTestStacks()
+		if err := applyListOptions(&stacks, expr, "", false, 0); err != nil {
+			t.Errorf("%q: unexpected error %v", expr, err)
+			continue
+		}
+		if got := guidsOf(stacks); got != want {
+			t.Errorf("%q: expected %s, got %s", expr, want, got)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	for _, expr := range []string{"plan", "plan=canary &&", "guid~[", "colour=red"} {
+		stacks := filterTestStacks()
+		if err := applyListOptions(&stacks, expr, "", false, 0); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestSortReverseAndLimit(t *testing.T) {
+	stacks := filterTestStacks()
+	if err := applyListOptions(&stacks, "", "deployed_at", false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := guidsOf(stacks); got != "aaa,bbb,ddd,ccc" {
+		t.Errorf("unexpected order %s", got)
+	}
+
+	stacks = filterTestStacks()
+	if err := applyListOptions(&stacks, "plan=canary", "status", true, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := guidsOf(stacks); got != "aaa,bbb" && got != "bbb,aaa" {
+		t.Errorf("unexpected order %s", got)
+	}
+
+	if err := applyListOptions(&stacks, "", "colour", false, 0); err == nil {
+		t.Error("expected an error sorting by an unknown field")
+	}
+}
+
+func TestFilterNestedFields(t *testing.T) {
+	units := []client.UnitSummary{
+		{Guid: "aaa", Version: client.FeatureVersion{Major: 1, Minor: 2}},
+		{Guid: "bbb", Version: client.FeatureVersion{Major: 2, Minor: 0}},
+	}
+	if err := applyListOptions(&units, "version.major>=2", "", false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 1 || units[0].Guid != "bbb" {
+		t.Errorf("unexpected units %+v", units)
+	}
+}
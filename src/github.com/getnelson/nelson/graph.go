@@ -0,0 +1,244 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/getnelson/nelson/client"
+)
+
+/*
+ * {
+ *   "root": "e4184c271bb9",
+ *   "nodes": [
+ *     { "guid": "e4184c271bb9", "stack_name": "howdy-http--1-0-344--9uuu9j4h", "depth": 0 },
+ *     { "guid": "7e8a7e3b9d53", "stack_name": "foo--1-0-2--9unk9j4h", "type": "service", "depth": 1 }
+ *   ],
+ *   "edges": [
+ *     { "from": "e4184c271bb9", "to": "7e8a7e3b9d53", "weight": 100 }
+ *   ]
+ * }
+ */
+type StackGraph struct {
+	Root  string           `json:"root"`
+	Nodes []StackGraphNode `json:"nodes"`
+	Edges []StackGraphEdge `json:"edges"`
+}
+
+type StackGraphNode struct {
+	Guid         string `json:"guid"`
+	StackName    string `json:"stack_name"`
+	Type         string `json:"type,omitempty"`
+	NamespaceRef string `json:"namespace,omitempty"`
+	Depth        int    `json:"depth"`
+}
+
+type StackGraphEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Weight int64  `json:"weight"`
+}
+
+const (
+	GraphFormatDot     = "dot"
+	GraphFormatMermaid = "mermaid"
+	GraphFormatJSON    = "json"
+)
+
+func isValidGraphFormat(format string) bool {
+	return format == GraphFormatDot || format == GraphFormatMermaid || format == GraphFormatJSON
+}
+
+/////////////////// BUILDING ///////////////////
+
+type graphBuilder struct {
+	mu    sync.Mutex
+	nodes map[string]*StackGraphNode
+	edges map[[2]string]StackGraphEdge
+}
+
+// records a node the first time it is seen; the shallowest depth wins
+// because the graph is walked one level at a time.
+func (b *graphBuilder) addNode(n StackGraphNode) bool {
+	if existing, ok := b.nodes[n.Guid]; ok {
+		if existing.Type == "" {
+			existing.Type = n.Type
+		}
+		return false
+	}
+	b.nodes[n.Guid] = &n
+	return true
+}
+
+func (b *graphBuilder) addEdge(e StackGraphEdge) {
+	b.edges[[2]string{e.From, e.To}] = e
+}
+
+// adds the dependencies of an inspected stack, returning the neighbours
+// that had not been seen before.
+func (b *graphBuilder) addSummary(s client.StackSummary, depth int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n, ok := b.nodes[s.Guid]; ok {
+		n.StackName = s.StackName
+		n.NamespaceRef = s.NamespaceRef
+	}
+
+	fresh := []string{}
+	neighbour := func(w client.Stack) {
+		if b.addNode(StackGraphNode{Guid: w.Guid, StackName: w.StackName, Type: w.Type, NamespaceRef: w.NamespaceRef, Depth: depth + 1}) {
+			fresh = append(fresh, w.Guid)
+		}
+	}
+	for _, w := range s.Dependencies.Outbound {
+		neighbour(w)
+		b.addEdge(StackGraphEdge{From: s.Guid, To: w.Guid, Weight: w.Weight})
+	}
+	for _, w := range s.Dependencies.Inbound {
+		neighbour(w)
+		b.addEdge(StackGraphEdge{From: w.Guid, To: s.Guid, Weight: w.Weight})
+	}
+	return fresh
+}
+
+func (b *graphBuilder) graph(root string) StackGraph {
+	g := StackGraph{Root: root, Nodes: []StackGraphNode{}, Edges: []StackGraphEdge{}}
+	for _, n := range b.nodes {
+		g.Nodes = append(g.Nodes, *n)
+	}
+	for _, e := range b.edges {
+		g.Edges = append(g.Edges, e)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		if g.Nodes[i].Depth != g.Nodes[j].Depth {
+			return g.Nodes[i].Depth < g.Nodes[j].Depth
+		}
+		return g.Nodes[i].Guid < g.Nodes[j].Guid
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// BuildStackGraph walks the dependencies of the root stack breadth first,
+// inspecting every stack up to depth hops away. At most concurrency
+// stacks are inspected at once. Stacks at the edge of the walk are
+// included with what their neighbours know about them.
+func BuildStackGraph(ctx context.Context, c *client.Client, root string, depth int, concurrency int) (StackGraph, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	b := &graphBuilder{
+		nodes: map[string]*StackGraphNode{},
+		edges: map[[2]string]StackGraphEdge{},
+	}
+	b.addNode(StackGraphNode{Guid: root, Depth: 0})
+
+	level := []string{root}
+	for d := 0; d < depth && len(level) > 0; d++ {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var firstErr error
+		next := []string{}
+		sem := make(chan struct{}, concurrency)
+
+		for _, guid := range level {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(guid string, d int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				s, err := c.InspectStack(ctx, guid)
+				if err == nil {
+					s.Guid = guid
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					return
+				}
+				next = append(next, b.addSummary(s, d)...)
+			}(guid, d)
+		}
+		wg.Wait()
+		if firstErr != nil {
+			return StackGraph{}, firstErr
+		}
+		level = next
+	}
+	return b.graph(root), nil
+}
+
+/////////////////// RENDERING ///////////////////
+
+func graphNodeLabel(n StackGraphNode) string {
+	label := n.StackName
+	if label == "" {
+		label = n.Guid
+	} else {
+		label = label + "\n" + n.Guid
+	}
+	if n.Type != "" {
+		label = label + "\n(" + n.Type + ")"
+	}
+	return label
+}
+
+func WriteGraphDot(w io.Writer, g StackGraph) {
+	fmt.Fprintf(w, "digraph %q {\n", g.Root)
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	for _, n := range g.Nodes {
+		style := ""
+		if n.Guid == g.Root {
+			style = ", style=bold"
+		}
+		fmt.Fprintf(w, "  %q [label=%q%s];\n", n.Guid, graphNodeLabel(n), style)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(w, "  %q -> %q [label=%q];\n", e.From, e.To, strconv.FormatInt(e.Weight, 10))
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func WriteGraphMermaid(w io.Writer, g StackGraph) {
+	escape := strings.NewReplacer(`"`, "#quot;", "\n", "<br/>")
+	fmt.Fprintln(w, "graph LR")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(w, "  s%s[\"%s\"]\n", n.Guid, escape.Replace(graphNodeLabel(n)))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(w, "  s%s -->|%d| s%s\n", e.From, e.Weight, e.To)
+	}
+	fmt.Fprintf(w, "  style s%s stroke-width:3px\n", g.Root)
+}
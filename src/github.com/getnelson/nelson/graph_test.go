@@ -0,0 +1,87 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getnelson/nelson/client"
+)
+
+// a -> b -> c, with d depending on a
+var graphFixtures = map[string]string{
+	"a": `{"guid": "a", "stack_name": "a--1-0-0", "dependencies": {"outbound": [{"guid": "b", "stack_name": "b--1-0-0", "type": "service", "weight": 100}], "inbound": [{"guid": "d", "stack_name": "d--1-0-0", "type": "job"}]}}`,
+	"b": `{"guid": "b", "stack_name": "b--1-0-0", "dependencies": {"outbound": [{"guid": "c", "stack_name": "c--1-0-0", "type": "service", "weight": 50}], "inbound": [{"guid": "a", "stack_name": "a--1-0-0"}]}}`,
+	"c": `{"guid": "c", "stack_name": "c--1-0-0", "dependencies": {"outbound": [], "inbound": [{"guid": "b", "stack_name": "b--1-0-0"}]}}`,
+	"d": `{"guid": "d", "stack_name": "d--1-0-0", "dependencies": {"outbound": [{"guid": "a", "stack_name": "a--1-0-0"}], "inbound": []}}`,
+}
+
+func graphTestClient(inspected *[]string) (*client.Client, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		guid := strings.TrimPrefix(r.URL.Path, "/v1/deployments/")
+		*inspected = append(*inspected, guid)
+		w.Write([]byte(graphFixtures[guid]))
+	}))
+	return client.New(server.URL, client.Session{}), server.Close
+}
+
+func TestBuildStackGraphDepth(t *testing.T) {
+	var inspected []string
+	c, done := graphTestClient(&inspected)
+	defer done()
+
+	g, err := BuildStackGraph(context.Background(), c, "a", 1, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(inspected) != 1 || len(g.Nodes) != 3 || len(g.Edges) != 2 {
+		t.Errorf("expected 1 inspection, 3 nodes and 2 edges, got %v, %v, %v", inspected, g.Nodes, g.Edges)
+	}
+
+	inspected = nil
+	g, err = BuildStackGraph(context.Background(), c, "a", 3, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(inspected) != 4 || len(g.Nodes) != 4 || len(g.Edges) != 3 {
+		t.Errorf("expected 4 inspections, 4 nodes and 3 edges, got %v, %v, %v", inspected, g.Nodes, g.Edges)
+	}
+	if g.Nodes[0].Guid != "a" || g.Nodes[0].StackName != "a--1-0-0" || g.Nodes[3].Guid != "c" || g.Nodes[3].Depth != 2 {
+		t.Errorf("unexpected node ordering: %v", g.Nodes)
+	}
+}
+
+func TestWriteGraphDot(t *testing.T) {
+	g := StackGraph{
+		Root:  "a",
+		Nodes: []StackGraphNode{{Guid: "a", StackName: "a--1-0-0"}, {Guid: "b", Type: "service", Depth: 1}},
+		Edges: []StackGraphEdge{{From: "a", To: "b", Weight: 100}},
+	}
+	var buf bytes.Buffer
+	WriteGraphDot(&buf, g)
+	out := buf.String()
+	for _, want := range []string{`digraph "a" {`, `"a" [label="a--1-0-0\na", style=bold];`, `"b" [label="b\n(service)"];`, `"a" -> "b" [label="100"];`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected dot output to contain %s, got:\n%s", want, out)
+		}
+	}
+}
@@ -17,155 +17,43 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"github.com/parnurzeal/gorequest"
 	"strconv"
 	"time"
-)
-
-/*
- * {
- *   "name": "howdy-lb",
- *   "major_version": 1,
- *   "datacenter": "us-east-1",
- *   "namespace": "dev"
- * }
- */
-type LoadbalancerCreate struct {
-	Name         string `json:"name"`
-	MajorVersion int    `json:"major_version"`
-	Datacenter   string `json:"datacenter"`
-	Namespace    string `json:"namespace"`
-}
-
-/*
- * {
- *   "name": "howdy-lb--1--974u8r6v",
- *   "routes": [
- *     ...
- *   ],
- *   "guid": "b74b8209468b",
- *   "deploy_time": 1481065235649,
- *   "datacenter": "us-east-1",
- *   "namespace": "dev"
- * }
- */
-type Loadbalancer struct {
-	Name         string              `json:"name"`
-	Routes       []LoadbalancerRoute `json:"routes"`
-	Guid         string              `json:"guid"`
-	DeployTime   int                 `json:"deploy_time"`
-	Datacenter   string              `json:"datacenter"`
-	Namespace    string              `json:"namespace"`
-	Address      string              `json:"address"`
-	Version      int                 `json:"major_version"`
-	Dependencies DependencyArray     `json:"dependencies"`
-}
 
-/*
- * {
- *   "backend_port_reference": "default",
- *   "backend_major_version": 1,
- *   "backend_name": "howdy-http",
- *   "lb_port": 8444
- * }
- */
-type LoadbalancerRoute struct {
-	BackendPortReference string `json:"backend_port_reference"`
-	BackendName          string `json:"backend_name"`
-	LBPort               int    `json:"lb_port"`
-}
+	"github.com/getnelson/nelson/client"
+)
 
-type DependencyArray struct {
-	Outbound []LoadbalancerDependencyOutbound `json:"outbound"`
+var loadbalancerColumns = []Column{
+	{Name: "guid", Header: "GUID", Value: func(r interface{}) string { return r.(client.Loadbalancer).Guid }},
+	{Name: "datacenter", Header: "Datacenter", Value: func(r interface{}) string { return r.(client.Loadbalancer).Datacenter }},
+	{Name: "namespace", Header: "Namespace", Value: func(r interface{}) string { return r.(client.Loadbalancer).Namespace }},
+	{Name: "name", Header: "Name", Value: func(r interface{}) string { return r.(client.Loadbalancer).Name }},
+	{Name: "routes", Header: "Routes", Value: func(r interface{}) string { return formatLoadbalancerRoutes(r.(client.Loadbalancer)) }},
+	{Name: "address", Header: "Address", Value: func(r interface{}) string { return r.(client.Loadbalancer).Address }},
+	{Name: "major_version", Header: "Version", Value: func(r interface{}) string { return strconv.Itoa(r.(client.Loadbalancer).Version) }, Optional: true},
 }
 
-type LoadbalancerDependencyOutbound struct {
-	DeployTime int    `json:"deployed_at"`
-	Type       string `json:"type"`
-	StackName  string `json:"stack_name"`
-	Guid       string `json:"guid"`
+func PrintListLoadbalancers(lb []client.Loadbalancer) {
+	RenderList(lb, loadbalancerColumns)
 }
 
-//////////////////////// LIST ////////////////////////
-
-func ListLoadbalancers(delimitedDcs string, delimitedNamespaces string, delimitedStatuses string, http *gorequest.SuperAgent, cfg *Config) (list []Loadbalancer, err []error) {
-	uri := "/v1/loadbalancers?"
-	// set the datacenters if specified
-	if isValidCommaDelimitedList(delimitedDcs) {
-		uri = uri + "dc=" + delimitedDcs + "&"
-	}
-	if isValidCommaDelimitedList(delimitedNamespaces) {
-		uri = uri + "ns=" + delimitedNamespaces
-	} else {
-		uri = uri + "ns=dev,qa,prod"
-	}
-
-	r, bytes, errs := AugmentRequest(
-		http.Get(cfg.Endpoint+uri), cfg).EndBytes()
+func formatLoadbalancerRoutes(l client.Loadbalancer) string {
+	routes := ""
+	for i, r := range l.Routes {
+		// 8443 ~> howdy-http->default
+		routes = routes + strconv.Itoa(r.LBPort) + " ~> " + r.BackendName + "->" + r.BackendPortReference
 
-	if r != nil {
-		if r.StatusCode/100 != 2 {
-			errs = append(errs, errors.New("bad response from Nelson server"))
-			return nil, errs
-		} else {
-			var list []Loadbalancer
-			if err := json.Unmarshal(bytes, &list); err != nil {
-				panic(err)
-			}
-			return list, errs
+		// if not the last element, lets bang on a comma
+		if i == len(l.Routes) {
+			routes = routes + ", "
 		}
-	} else {
-		errs = append(errs, errors.New("No response from the Nelson server, aborting."))
-		return nil, errs
 	}
+	return routes
 }
 
-func PrintListLoadbalancers(lb []Loadbalancer) {
-	var tabulized = [][]string{}
-	for _, l := range lb {
-		routes := ""
-		for i, r := range l.Routes {
-			// 8443 ~> howdy-http->default
-			routes = routes + strconv.Itoa(r.LBPort) + " ~> " + r.BackendName + "->" + r.BackendPortReference
-
-			// if not the last element, lets bang on a comma
-			if i == len(l.Routes) {
-				routes = routes + ", "
-			}
-		}
-		tabulized = append(tabulized, []string{l.Guid, l.Datacenter, l.Namespace, l.Name, routes, l.Address})
-	}
-
-	RenderTableToStdout([]string{"GUID", "Datacenter", "Namespace", "Name", "Routes", "Address"}, tabulized)
-}
-
-func InspectLoadBalancer(guid string, http *gorequest.SuperAgent, cfg *Config) (lb Loadbalancer, err []error) {
-	uri := "/v1/loadbalancers/" + guid
-	r, bytes, errs := AugmentRequest(
-		http.Get(cfg.Endpoint+uri), cfg).EndBytes()
-
-	if errs != nil {
-		return Loadbalancer{}, errs
-	}
-
-	if r.StatusCode/100 != 2 {
-		errs = append(errs, errors.New("bad response from Nelson server"))
-		_ = bytes
-		return Loadbalancer{}, errs
-	} else {
-		var lb Loadbalancer
-		if err := json.Unmarshal(bytes, &lb); err != nil {
-			panic(err)
-		}
-		return lb, errs
-	}
-	return Loadbalancer{}, errs
-}
-
-func PrintInspectLoadbalancer(lb Loadbalancer) {
+func PrintInspectLoadbalancer(lb client.Loadbalancer) {
 	var tabulized = [][]string{}
 	tabulized = append(tabulized, []string{"GUID:", lb.Guid})
 	tabulized = append(tabulized, []string{"NAME:", lb.Name})
@@ -181,7 +69,7 @@ func PrintInspectLoadbalancer(lb Loadbalancer) {
 		fmt.Println("===>> Routes")
 		var routes = [][]string{}
 
-		var w LoadbalancerRoute
+		var w client.LoadbalancerRoute
 		for _, w = range lb.Routes {
 			routes = append(routes, []string{w.BackendPortReference, w.BackendName, strconv.FormatInt(int64(w.LBPort), 10)})
 		}
@@ -193,7 +81,7 @@ func PrintInspectLoadbalancer(lb Loadbalancer) {
 		fmt.Println("===>> Outbound Dependencies")
 		var dependencies = [][]string{}
 
-		var r LoadbalancerDependencyOutbound
+		var r client.LoadbalancerDependencyOutbound
 		for _, r = range lb.Dependencies.Outbound {
 			dependencies = append(dependencies, []string{time.Unix(int64(r.DeployTime)/1000, 0).Format(time.RFC3339), r.Type, r.StackName, r.Guid})
 		}
@@ -201,55 +89,17 @@ func PrintInspectLoadbalancer(lb Loadbalancer) {
 	}
 }
 
-//////////////////////// REMOVE ////////////////////////
-
-func RemoveLoadBalancer(guid string, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-	r, body, errs := AugmentRequest(
-		http.Delete(cfg.Endpoint+"/v1/loadbalancers/"+guid), cfg).EndBytes()
-
-	if errs != nil {
-		return "", errs
-	}
-
-	rcode := r.StatusCode / 100
-	if rcode != 2 {
-		resp := string(body[:])
-		if rcode == 4 {
-			errs = append(errs, errors.New("The request was invalid: "+resp))
-		} else if rcode == 5 {
-			errs = append(errs, errors.New("Nelson server appears to be having trouble completing this request. Please seek assistance from an administrator. "+resp))
-		} else {
-			errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		}
-		return resp, errs
-	} else {
-		return "Requested removal of " + guid, errs
-	}
-}
-
-//////////////////////// CREATE ////////////////////////
-
-func CreateLoadBalancer(req LoadbalancerCreate, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-	r, body, errs := AugmentRequest(
-		http.Post(cfg.Endpoint+"/v1/loadbalancers"), cfg).Send(req).EndBytes()
-
-	if errs != nil {
-		return "", errs
-	}
-
-	rcode := r.StatusCode / 100
-	if rcode != 2 {
-		resp := string(body[:])
-		if rcode == 4 {
-			errs = append(errs, errors.New("The request was invalid: "+resp))
-		} else if rcode == 5 {
-			errs = append(errs, errors.New("Nelson server appears to be having trouble completing this request. Please seek assistance from an administrator. "+resp))
-		} else {
-			errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		}
-
-		return resp, errs
-	} else {
-		return "Loadbalancer has been created.", errs
+// DescribeLoadbalancer looks up a load balancer for a confirmation prompt.
+func DescribeLoadbalancer(ctx context.Context, c *client.Client, guid string) ([][]string, error) {
+	lb, err := c.InspectLoadBalancer(ctx, guid)
+	if err != nil {
+		return nil, err
 	}
+	return [][]string{
+		{"GUID", lb.Guid},
+		{"Name", lb.Name},
+		{"Namespace", lb.Namespace},
+		{"Datacenter", lb.Datacenter},
+		{"Address", lb.Address},
+	}, nil
 }
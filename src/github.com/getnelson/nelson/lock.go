@@ -14,33 +14,28 @@
 //:   limitations under the License.
 //:
 //: ----------------------------------------------------------------------------
+//go:build !windows
+// +build !windows
+
 package main
 
 import (
-	"fmt"
-	"github.com/parnurzeal/gorequest"
-	"regexp"
+	"os"
+	"syscall"
 )
 
-var sanitizer = regexp.MustCompile("\"Cookie: nelson.session=(.*)\"")
-
-type FilteredLog struct {
-	logger gorequest.Logger
-}
-
-func FilterLog(logger gorequest.Logger) *FilteredLog {
-	return &FilteredLog{logger: logger}
-}
-
-func (f FilteredLog) SetPrefix(s string) {
-	f.logger.SetPrefix(s)
-}
-
-func (f FilteredLog) Printf(format string, v ...interface{}) {
-	s := fmt.Sprintf(format, v)
-	f.logger.Println(sanitizer.ReplaceAllString(s, "\"Cookie: nelson.session=<redacted>\""))
-}
+// runs fn while holding an exclusive lock on a file next to the config
+// file, so that concurrent cli runs take turns changing it.
+func withConfigLock(configPath string, fn func() error) error {
+	lock, err := os.OpenFile(configPath+".lock", os.O_CREATE|os.O_RDWR, configFileMode)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
 
-func (f FilteredLog) Println(v ...interface{}) {
-	f.logger.Println(v)
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+	return fn()
 }
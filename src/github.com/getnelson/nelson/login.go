@@ -17,31 +17,169 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
+	"net/http"
 
-	"github.com/parnurzeal/gorequest"
+	"github.com/getnelson/nelson/client"
 )
 
-type CreateSessionRequest struct {
-	AccessToken string `json:"access_token"`
+///////////////////////////// CLI ENTRYPOINT ////////////////////////////////
+
+// Login creates a session against target.Endpoint and stores it in the
+// named context. The connection settings of target (Auth, TLS and Proxy)
+// are used for the login itself and saved with the context; any that
+// are left empty keep whatever the context used before.
+func Login(ctx context.Context, githubToken string, contextName string, target Config) error {
+	if existing, err := readContext(contextName); err == nil {
+		target = inheritConnectionSettings(target, existing)
+	}
+	c := NewClient(&Config{Endpoint: target.Endpoint, TLS: target.TLS, Proxy: target.Proxy})
+	c.DryRun = false // creating a session changes nothing in nelson, and renewals depend on it
+	sess, err := c.CreateSession(ctx, githubToken)
+	if err != nil {
+		return err
+	}
+	// a missing file just means this is the first context
+	return updateConfigFile(defaultConfigPath(), func(file *ConfigFile) error {
+		store, err := file.credentialStore()
+		if err != nil {
+			return err
+		}
+		file.SetContext(contextName, Config{
+			Endpoint:      target.Endpoint,
+			Auth:          target.Auth,
+			ConfigSession: ConfigSession{ExpiresAt: sess.ExpiresAt},
+			TLS:           target.TLS,
+			Proxy:         target.Proxy,
+		})
+		return store.Set(contextName, sess.SessionToken)
+	})
 }
 
-// { "session_token": "xxx", "expires_at": 12345 }
-type Session struct {
-	SessionToken string `json:"session_token"`
-	ExpiresAt    int64  `json:"expires_at"`
+// fills in the connection settings target leaves empty from existing.
+func inheritConnectionSettings(target Config, existing Config) Config {
+	if len(target.Auth) == 0 {
+		target.Auth = existing.Auth
+	}
+	if target.TLS == (ConfigTLS{}) {
+		target.TLS = existing.TLS
+	}
+	if len(target.Proxy) == 0 {
+		target.Proxy = existing.Proxy
+	}
+	return target
 }
 
-///////////////////////////// CLI ENTRYPOINT ////////////////////////////////
+// the context as it is stored, before any session is loaded.
+func readContext(name string) (Config, error) {
+	e, file := readConfigFile(defaultConfigPath())
+	if e != nil {
+		return Config{}, e
+	}
+	c, e := file.GetContext(name)
+	if e != nil {
+		return Config{}, e
+	}
+	return c.Config, nil
+}
+
+/*
+ * {
+ *   "context": "staging",
+ *   "invalidated": false,
+ *   "error": "Get https://nelson.staging.yourcompany.com/session: dial tcp: i/o timeout"
+ * }
+ */
+type LogoutResult struct {
+	Context     string `json:"context"`
+	Invalidated bool   `json:"invalidated"`
+	Error       string `json:"error,omitempty"`
+	// set when the session could not be removed locally either
+	RemoveError string `json:"remove_error,omitempty"`
+}
+
+const (
+	noSessionToInvalidate   = "there was no session to invalidate"
+	invalidationUnsupported = "the server does not support invalidating sessions"
+)
 
-func Login(client *gorequest.SuperAgent, githubToken string, nelsonHost string, disableTLS bool) []error {
-	baseURL := createEndpointURL(nelsonHost, !disableTLS)
-	sess, errs := createSession(client, githubToken, baseURL)
-	if errs != nil {
-		return errs
+// the session was removed locally, and any failure to invalidate it on
+// the server was not one that logging out again could fix.
+func (r LogoutResult) succeeded() bool {
+	return len(r.RemoveError) == 0 && (r.Invalidated || r.Error == noSessionToInvalidate || r.Error == invalidationUnsupported)
+}
+
+// Logout invalidates the session of each named context on its server,
+// then scrubs the sessions from the config file and the credential store
+// whatever happened on the servers. A session the server already rejects
+// counts as invalidated. The error is only set when the config file
+// itself could not be read or written.
+func Logout(ctx context.Context, contextNames []string) ([]LogoutResult, error) {
+	err, file := readConfigFile(defaultConfigPath())
+	if err != nil {
+		return nil, err
+	}
+
+	results := []LogoutResult{}
+	for _, name := range contextNames {
+		result := LogoutResult{Context: name}
+		cfg, err := file.loadConfig(name)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case len(cfg.Token) == 0:
+			result.Error = noSessionToInvalidate
+		default:
+			cfg.contextName = "" // so that it is never renewed
+			e := NewClient(cfg).DeleteSession(ctx)
+			switch {
+			case e == client.ErrDryRun:
+				return nil, e
+			case e == nil || client.IsStatus(e, http.StatusUnauthorized):
+				result.Invalidated = true
+			case client.IsStatus(e, http.StatusNotFound) || client.IsStatus(e, http.StatusMethodNotAllowed):
+				result.Error = invalidationUnsupported
+			default:
+				result.Error = e.Error()
+			}
+		}
+		results = append(results, result)
+	}
+
+	scrubbed := ModifyContexts(func(f *ConfigFile) error {
+		store, serr := f.credentialStore()
+		for i, name := range contextNames {
+			c, err := f.GetContext(name)
+			if err != nil {
+				continue
+			}
+			c.ConfigSession = ConfigSession{}
+			if serr == nil {
+				err = store.Delete(name)
+			} else {
+				err = serr
+			}
+			if err != nil {
+				results[i].RemoveError = err.Error()
+			}
+		}
+		return nil
+	})
+	return results, scrubbed
+}
+
+func PrintLogoutResults(results []LogoutResult) {
+	for _, r := range results {
+		switch {
+		case len(r.RemoveError) > 0:
+			fmt.Println("===>> Unable to remove the stored session for context '" + r.Context + "': " + r.RemoveError)
+		case r.Invalidated:
+			fmt.Println("===>> Logged out of context '" + r.Context + "'.")
+		default:
+			fmt.Println("===>> Removed the session for context '" + r.Context + "' locally, but it was not invalidated on the server: " + r.Error)
+		}
 	}
-	writeConfigFile(sess, baseURL, defaultConfigPath()) // TIM: side-effect, discarding errors seems wrong
-	return nil
 }
 
 ///////////////////////////// INTERNALS ////////////////////////////////
@@ -54,28 +192,3 @@ func createEndpointURL(host string, useTLS bool) string {
 		return "http" + u
 	}
 }
-
-/* TODO: any error handling here... would be nice */
-func createSession(client *gorequest.SuperAgent, githubToken string, baseURL string) (Session, []error) {
-	ver := CreateSessionRequest{AccessToken: githubToken}
-	url := baseURL + "/auth/github"
-	_, bytes, errs := client.
-		Post(url).
-		Set("User-Agent", UserAgentString(globalBuildVersion)).
-		Send(ver).
-		SetCurlCommand(globalEnableCurl).
-		SetDebug(globalEnableDebug).
-		Timeout(GetTimeout(globalTimeoutSeconds)).
-		EndBytes()
-
-	if len(errs) > 0 {
-		return Session{}, errs
-	}
-
-	var result Session
-	if err := json.Unmarshal(bytes, &result); err != nil {
-		return Session{}, []error{err}
-	}
-
-	return result, nil
-}
@@ -0,0 +1,138 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogoutScrubsSessions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	deleted := 0
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" && r.URL.Path == "/session" {
+			deleted++
+		}
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close() // unreachable
+	unsupported := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer unsupported.Close()
+
+	file := &ConfigFile{}
+	file.SetContext("staging", Config{Endpoint: up.URL, ConfigSession: ConfigSession{Token: "a", ExpiresAt: 1}})
+	file.SetContext("prod", Config{Endpoint: down.URL, ConfigSession: ConfigSession{Token: "b", ExpiresAt: 1}})
+	file.SetContext("old", Config{Endpoint: up.URL})
+	file.SetContext("legacy", Config{Endpoint: unsupported.URL, ConfigSession: ConfigSession{Token: "c", ExpiresAt: 1}})
+	if err := writeConfigFile(file, defaultConfigPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Logout(context.Background(), []string{"staging", "prod", "old", "legacy"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if deleted != 1 {
+		t.Error("expected one session to be deleted on the server, got", deleted)
+	}
+	if !results[0].Invalidated || results[1].Invalidated || results[1].Error == "" || results[2].Error != noSessionToInvalidate {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	if results[1].succeeded() || !results[2].succeeded() || !results[3].succeeded() || results[3].Error != invalidationUnsupported {
+		t.Errorf("expected only the unreachable server to fail the logout, got %+v", results)
+	}
+
+	_, after := readConfigFile(defaultConfigPath())
+	for _, cc := range after.Contexts {
+		if cc.Token != "" || cc.ExpiresAt != 0 {
+			t.Errorf("expected the session for %s to be scrubbed, got %+v", cc.Name, cc.ConfigSession)
+		}
+	}
+}
+
+func TestLogoutScrubsSessionsItCannotLoad(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	file := &ConfigFile{CredentialStore: CredentialStoreHelper, CredentialHelper: "false"}
+	file.SetContext("staging", Config{Endpoint: "http://127.0.0.1:1", ConfigSession: ConfigSession{ExpiresAt: 1}})
+	file.SetContext("prod", Config{Endpoint: "http://127.0.0.1:1", ConfigSession: ConfigSession{ExpiresAt: 1}})
+	if err := writeConfigFile(file, defaultConfigPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Logout(context.Background(), []string{"staging", "prod"})
+	if err != nil {
+		t.Fatal("unexpected error", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected a result for every context, got %+v", results)
+	}
+	for _, r := range results {
+		if r.Error == "" || r.RemoveError == "" || r.succeeded() {
+			t.Errorf("expected the failing credential helper to be reported, got %+v", r)
+		}
+	}
+	_, after := readConfigFile(defaultConfigPath())
+	for _, cc := range after.Contexts {
+		if cc.ExpiresAt != 0 {
+			t.Errorf("expected the session for %s to be scrubbed, got %+v", cc.Name, cc.ConfigSession)
+		}
+	}
+}
+
+func TestLoginKeepsConnectionSettings(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// nelson.example.com only resolves through the proxy
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "nelson.example.com" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"session_token": "abc", "expires_at": 1}`))
+	}))
+	defer proxy.Close()
+
+	first := Config{
+		Endpoint: "http://nelson.example.com",
+		TLS:      ConfigTLS{ServerName: "nelson.internal"},
+		Proxy:    proxy.URL,
+	}
+	if err := Login(context.Background(), "token", "staging", first); err != nil {
+		t.Fatal(err)
+	}
+	// logging in again without any settings keeps the ones saved before
+	if err := Login(context.Background(), "token", "staging", Config{Endpoint: "http://nelson.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, file := readConfigFile(defaultConfigPath())
+	saved, err := file.GetContext("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.TLS.ServerName != "nelson.internal" || saved.Proxy != proxy.URL {
+		t.Errorf("unexpected settings: %+v", saved.Config)
+	}
+}
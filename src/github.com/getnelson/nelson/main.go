@@ -17,25 +17,27 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/parnurzeal/gorequest"
+	"github.com/getnelson/nelson/client"
 	"gopkg.in/urfave/cli.v1"
 )
 
 var globalTimeoutSeconds int
 var globalEnableDebug bool
 var globalEnableCurl bool
+var globalDryRun bool
 var globalBuildVersion string
+var globalContext string
 
 func main() {
 	year, _, _ := time.Now().Date()
@@ -46,8 +48,7 @@ func main() {
 	app.Usage = "remote control for the Nelson deployment system"
 	app.EnableBashCompletion = true
 
-	http := gorequest.New()
-	http.SetLogger(FilterLog(log.New(os.Stderr, "[gorequest]", log.LstdFlags)))
+	ctx := context.Background()
 	pi := ProgressIndicator()
 
 	// switches for the cli
@@ -70,6 +71,26 @@ func main() {
 	var repository string
 	var owner string
 	var selectedName string
+	var selectedFollow bool
+	var selectedOffset int
+	var selectedTail int
+	var selectedInterval time.Duration
+	var selectedWaitTimeout time.Duration
+	var selectedDepth int
+	var selectedGraphFormat string
+	var selectedConcurrency int
+	var selectedOffline bool
+	var selectedYes bool
+	var selectedAllContexts bool
+	var selectedAuth string
+	var selectedTLS ConfigTLS
+	var selectedProxy string
+	var selectedThrough string
+	var selectedThresholds CanaryThresholds
+	var selectedDuration time.Duration
+	var selectedBulk BulkOptions
+	var selectedLast int
+	var selectedGap time.Duration
 
 	app.Flags = []cli.Flag{
 		cli.IntFlag{
@@ -87,6 +108,80 @@ func main() {
 			Usage:       "Print the curl command analog for the current request",
 			Destination: &globalEnableCurl,
 		},
+		cli.BoolFlag{
+			Name:        "dry-run",
+			Usage:       "Print the first request that would change anything in Nelson instead of sending it",
+			Destination: &globalDryRun,
+		},
+		cli.StringFlag{
+			Name:        "context",
+			Usage:       "Use the named context from the config file rather than the current one",
+			Destination: &globalContext,
+		},
+		cli.StringFlag{
+			Name:        "output, o",
+			Value:       OutputTable,
+			Usage:       "Output format for command results: table, json or yaml",
+			Destination: &globalOutputFormat,
+		},
+		cli.StringFlag{
+			Name:        "format",
+			Usage:       "Go template applied to each row of a list, e.g. '{{.Guid}} {{.StackName}}'",
+			Destination: &globalFormat,
+		},
+		cli.StringFlag{
+			Name:        "columns",
+			Usage:       "Comma delimited list of the table columns to show, e.g. guid,status,deployed_at",
+			Destination: &globalColumns,
+		},
+		cli.BoolFlag{
+			Name:        "no-headers",
+			Usage:       "Leave the header row out of tables",
+			Destination: &globalNoHeaders,
+		},
+		cli.StringFlag{
+			Name:        "filter",
+			Usage:       "Only list the rows matching an expression, e.g. 'plan=canary && deployed_at>7d'",
+			Destination: &globalFilter,
+		},
+		cli.StringFlag{
+			Name:        "sort-by",
+			Usage:       "Sort lists by the named field, e.g. deployed_at",
+			Destination: &globalSortBy,
+		},
+		cli.BoolFlag{
+			Name:        "reverse",
+			Usage:       "Reverse the order of lists, after any --sort-by",
+			Destination: &globalReverse,
+		},
+		cli.IntFlag{
+			Name:        "limit",
+			Usage:       "List at most this many rows, after filtering and sorting",
+			Destination: &globalLimit,
+		},
+	}
+
+	app.Before = func(c *cli.Context) error {
+		if !isValidOutputFormat(globalOutputFormat) {
+			return cli.NewExitError("The --output format must be one of table, json or yaml.", 1)
+		}
+		if (len(globalFormat) > 0 || len(globalColumns) > 0) && isStructuredOutput() {
+			return cli.NewExitError("--format and --columns only apply to table output.", 1)
+		}
+		if len(globalFormat) > 0 && len(globalColumns) > 0 {
+			return cli.NewExitError("--format and --columns cannot be used together.", 1)
+		}
+		if _, e := parseFilter(globalFilter); e != nil {
+			return cli.NewExitError(e.Error(), 1)
+		}
+		if globalLimit < 0 {
+			return cli.NewExitError("--limit cannot be negative.", 1)
+		}
+		if isStructuredOutput() {
+			// keep stdout clean for whatever is consuming the output
+			pi.Writer = os.Stderr
+		}
+		return nil
 	}
 
 	app.Commands = []cli.Command{
@@ -106,6 +201,41 @@ func main() {
 					Name:        "disable-tls",
 					Destination: &disableTLS,
 				},
+				cli.StringFlag{
+					Name:        "auth",
+					Usage:       "How to send the session to nelson: cookie or bearer. Defaults to cookie, or what the context used before",
+					Destination: &selectedAuth,
+				},
+				cli.StringFlag{
+					Name:        "ca-file",
+					Usage:       "PEM bundle of certificate authorities to trust for this context, in addition to the system ones",
+					Destination: &selectedTLS.CAFile,
+				},
+				cli.StringFlag{
+					Name:        "cert-file",
+					Usage:       "PEM client certificate to present, when nelson requires mutual TLS",
+					Destination: &selectedTLS.CertFile,
+				},
+				cli.StringFlag{
+					Name:        "key-file",
+					Usage:       "PEM private key of the --cert-file",
+					Destination: &selectedTLS.KeyFile,
+				},
+				cli.StringFlag{
+					Name:        "server-name",
+					Usage:       "Name the server certificate must match, when it differs from the host",
+					Destination: &selectedTLS.ServerName,
+				},
+				cli.BoolFlag{
+					Name:        "insecure-skip-verify",
+					Usage:       "Do not verify the server certificate at all. Dangerous; for testing only",
+					Destination: &selectedTLS.InsecureSkipVerify,
+				},
+				cli.StringFlag{
+					Name:        "proxy",
+					Usage:       "HTTP(S) proxy to reach nelson through, e.g. http://proxy.yourcompany.com:3128. Defaults to $HTTPS_PROXY",
+					Destination: &selectedProxy,
+				},
 			},
 			Action: func(c *cli.Context) error {
 				host := strings.TrimSpace(c.Args().First())
@@ -119,21 +249,163 @@ func main() {
 				if len(userGithubToken) <= 0 {
 					return cli.NewExitError("You must set your GITHUB_TOKEN environment variable or specify a token using -t", 1)
 				}
+				if len(selectedAuth) > 0 && selectedAuth != client.AuthCookie && selectedAuth != client.AuthBearer {
+					return cli.NewExitError("--auth must be either cookie or bearer.", 1)
+				}
 
 				// fmt.Println("token: ", userGithubToken)
 				// fmt.Println("host: ", host)
+				_, file := readConfigFile(defaultConfigPath())
+				contextName := file.selectContextName(globalContext)
+
 				pi.Start()
-				errs := Login(http, userGithubToken, host, disableTLS)
+				target := Config{
+					Endpoint: createEndpointURL(host, !disableTLS),
+					Auth:     selectedAuth,
+					TLS:      selectedTLS.absolute(),
+					Proxy:    selectedProxy,
+				}
+				e := Login(ctx, userGithubToken, contextName, target)
 				pi.Stop()
-				if len(errs) != 0 {
-					PrintTerminalErrors(errs)
-					return cli.NewExitError("Login failed.", 1)
+				if e != nil {
+					return commandError(e, "Login failed.", 1)
 				}
 
-				fmt.Println("Successfully logged in to " + host)
+				RenderMessage("", "Successfully logged in to "+host+" (context '"+contextName+"')")
 				return nil
 			},
 		},
+		{
+			Name:  "logout",
+			Usage: "Invalidate your session and remove it from the config file",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:        "all-contexts",
+					Usage:       "Log out of every context rather than just the current one",
+					Destination: &selectedAllContexts,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				err, file := readConfigFile(defaultConfigPath())
+				if err != nil {
+					return cli.NewExitError("Unable to read the config file; there is nothing to log out of.", 1)
+				}
+				names := []string{file.selectContextName(globalContext)}
+				if selectedAllContexts {
+					names = []string{}
+					for _, cc := range file.Contexts {
+						names = append(names, cc.Name)
+					}
+				}
+
+				pi.Start()
+				results, e := Logout(ctx, names)
+				pi.Stop()
+				if results == nil && e != nil {
+					return commandError(e, "Logout failed.", 1)
+				}
+				Render(results, func() { PrintLogoutResults(results) })
+				if e != nil {
+					return commandError(e, "Unable to remove the sessions from the config file.", 1)
+				}
+				for _, r := range results {
+					if !r.succeeded() {
+						return cli.NewExitError("Not every session could be logged out of.", 1)
+					}
+				}
+				return nil
+			},
+		},
+		////////////////////////////// CONTEXTS //////////////////////////////////
+		{
+			Name:    "contexts",
+			Aliases: []string{"context", "ctx"},
+			Usage:   "Set of commands for managing the named connection profiles in your config file",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "List the available contexts, marking the current one",
+					Action: func(c *cli.Context) error {
+						err, file := readConfigFile(defaultConfigPath())
+						if err != nil {
+							return cli.NewExitError("Unable to read the config file. You need to `nelson login` first.", 1)
+						}
+						contexts := SummarizeContexts(file)
+						RenderRows(&contexts, func() { PrintListContexts(contexts) })
+						return nil
+					},
+				},
+				{
+					Name:  "use",
+					Usage: "Make the named context the one used by subsequent commands",
+					Action: func(c *cli.Context) error {
+						name := c.Args().First()
+						if len(name) == 0 {
+							return cli.NewExitError("You must specify the name of the context to use.", 1)
+						}
+						e := ModifyContexts(func(f *ConfigFile) error {
+							return f.UseContext(name)
+						})
+						if e != nil {
+							return cli.NewExitError(e.Error(), 1)
+						}
+						RenderMessage("===>> ", "Switched to context '"+name+"'")
+						return nil
+					},
+				},
+				{
+					Name:  "rename",
+					Usage: "Rename a context, e.g. `nelson context rename default prod`",
+					Action: func(c *cli.Context) error {
+						from := c.Args().Get(0)
+						to := c.Args().Get(1)
+						if len(from) == 0 || len(to) == 0 {
+							return cli.NewExitError("You must specify both the existing and the new context name.", 1)
+						}
+						e := ModifyContexts(func(f *ConfigFile) error {
+							store, err := f.credentialStore()
+							if err != nil {
+								return err
+							}
+							if err := f.RenameContext(from, to); err != nil {
+								return err
+							}
+							return renameCredential(store, from, to)
+						})
+						if e != nil {
+							return cli.NewExitError(e.Error(), 1)
+						}
+						RenderMessage("===>> ", "Renamed context '"+from+"' to '"+to+"'")
+						return nil
+					},
+				},
+				{
+					Name:  "delete",
+					Usage: "Remove a context and its session from the config file",
+					Action: func(c *cli.Context) error {
+						name := c.Args().First()
+						if len(name) == 0 {
+							return cli.NewExitError("You must specify the name of the context to delete.", 1)
+						}
+						e := ModifyContexts(func(f *ConfigFile) error {
+							store, err := f.credentialStore()
+							if err != nil {
+								return err
+							}
+							if err := f.DeleteContext(name); err != nil {
+								return err
+							}
+							return store.Delete(name)
+						})
+						if e != nil {
+							return cli.NewExitError(e.Error(), 1)
+						}
+						RenderMessage("===>> ", "Deleted context '"+name+"'")
+						return nil
+					},
+				},
+			},
+		},
 		////////////////////////////// BLUEPRINTS //////////////////////////////////
 		{
 			Name:    "blueprints",
@@ -160,16 +432,15 @@ func main() {
 							return cli.NewExitError("Could not read "+selectedManifest, 1)
 						}
 						manifestBase64 := base64.StdEncoding.EncodeToString(manifest)
-						wire := ProofBlueprintWire{Content: manifestBase64}
+						wire := client.ProofBlueprintWire{Content: manifestBase64}
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						r, e := ProofBlueprint(wire, http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						r, e := NewClient(cfg).ProofBlueprint(ctx, wire)
 						pi.Stop()
 						if e != nil {
-							return cli.NewExitError("Unable to proof blueprint.", 1)
+							return commandError(e, "Unable to proof blueprint.", 1)
 						} else {
-							fmt.Println(r)
-							// PrintListDatacenters(r)
+							RenderMessage("", r)
 						}
 						return nil
 					},
@@ -208,7 +479,7 @@ func main() {
 						sum := sha256.Sum256(manifest)
 						sha := fmt.Sprintf("%x", sum)
 						manifestBase64 := base64.StdEncoding.EncodeToString(manifest)
-						wire := CreateBlueprintRequest{
+						wire := client.CreateBlueprintRequest{
 							Name:        selectedName,
 							Description: description,
 							Sha256:      sha,
@@ -216,15 +487,16 @@ func main() {
 						}
 
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						r, e := CreateBlueprint(wire, http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						r, e := NewClient(cfg).CreateBlueprint(ctx, wire)
 						pi.Stop()
 						if e != nil {
-							PrintTerminalErrors(e)
-							return cli.NewExitError("Unable to create blueprint.", 1)
+							return commandError(e, "Unable to create blueprint.", 1)
 						} else {
-							fmt.Println("Successfully created blueprint " + r.Name + "@" + r.Revision + ".")
-							fmt.Println("@HEAD will point to revision " + r.Revision + " until future revisions are committed.")
+							Render(r, func() {
+								fmt.Println("Successfully created blueprint " + r.Name + "@" + r.Revision + ".")
+								fmt.Println("@HEAD will point to revision " + r.Revision + " until future revisions are committed.")
+							})
 						}
 						return nil
 					},
@@ -256,14 +528,13 @@ func main() {
 						}
 
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						r, e := InspectBlueprint(bpName, http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						r, e := NewClient(cfg).InspectBlueprint(ctx, bpName)
 						pi.Stop()
 						if e != nil {
-							PrintTerminalErrors(e)
-							return cli.NewExitError("Unable to create blueprint.", 1)
+							return commandError(e, "Unable to create blueprint.", 1)
 						} else {
-							fmt.Println(r.Template)
+							Render(r, func() { fmt.Println(r.Template) })
 						}
 						return nil
 					},
@@ -273,13 +544,13 @@ func main() {
 					Usage: "List all the available blueprints",
 					Action: func(c *cli.Context) error {
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						r, e := ListBlueprints(http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						r, e := NewClient(cfg).ListBlueprints(ctx)
 						pi.Stop()
 						if e != nil {
-							return cli.NewExitError("Unable to list blueprints.", 1)
+							return commandError(e, "Unable to list blueprints.", 1)
 						} else {
-							PrintListBlueprints(r)
+							RenderRows(&r, func() { PrintListBlueprints(r) })
 						}
 						return nil
 					},
@@ -297,13 +568,13 @@ func main() {
 					Usage: "List all the available datacenters",
 					Action: func(c *cli.Context) error {
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						r, e := ListDatacenters(http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						r, e := NewClient(cfg).ListDatacenters(ctx)
 						pi.Stop()
 						if e != nil {
-							return cli.NewExitError("Unable to list datacenters.", 1)
+							return commandError(e, "Unable to list datacenters.", 1)
 						} else {
-							PrintListDatacenters(r)
+							RenderRows(&r, func() { PrintListDatacenters(r) })
 						}
 						return nil
 					},
@@ -321,14 +592,13 @@ func main() {
 					Usage: "Synchronize the available repositories with GitHub",
 					Action: func(c *cli.Context) error {
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						e := SyncRepos(http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						e := NewClient(cfg).SyncRepos(ctx)
 						pi.Stop()
 						if e != nil {
-							fmt.Println(e)
-							return cli.NewExitError("Unable to synchronize repositories.", 1)
+							return commandError(e, "Unable to synchronize repositories.", 1)
 						}
-						fmt.Println("Successfully synchronized repositories.")
+						RenderMessage("", "Successfully synchronized repositories.")
 						return nil
 					},
 				},
@@ -346,13 +616,13 @@ func main() {
 					Action: func(c *cli.Context) error {
 						if len(owner) > 0 {
 							pi.Start()
-							cfg := LoadDefaultConfigOrExit(http)
-							r, e := ListRepos(owner, http, cfg)
+							cfg := LoadDefaultConfigOrExit()
+							r, e := NewClient(cfg).ListRepos(ctx, owner)
 							pi.Stop()
 							if e != nil {
-								return cli.NewExitError("Unable to list project statuses. Sorry!", 1)
+								return commandError(e, "Unable to list project statuses. Sorry!", 1)
 							} else {
-								PrintListRepos(r)
+								RenderRows(&r, func() { PrintListRepos(r) })
 								return nil
 							}
 						} else {
@@ -380,18 +650,18 @@ func main() {
 					Action: func(c *cli.Context) error {
 						if len(owner) > 0 {
 							if len(repository) > 0 {
-								req := EnableRepoRequest{
+								req := client.EnableRepoRequest{
 									Owner: owner,
 									Repo:  repository,
 								}
 								pi.Start()
-								cfg := LoadDefaultConfigOrExit(http)
-								r, e := Enable(req, http, cfg)
+								cfg := LoadDefaultConfigOrExit()
+								e := NewClient(cfg).Enable(ctx, req)
 								pi.Stop()
 								if e != nil {
-									return cli.NewExitError("Unable to enable project "+req.Owner+"/"+req.Repo+". Response was:\n"+r, 1)
+									return commandError(e, "Unable to enable project "+req.Owner+"/"+req.Repo+".", 1)
 								} else {
-									fmt.Println(r)
+									RenderMessage("", "The project "+req.Owner+"/"+req.Repo+" has been enabled.")
 								}
 							} else {
 								return cli.NewExitError("You must supply a --repository or --repo or -r argument to specify the repository", 1)
@@ -418,22 +688,31 @@ func main() {
 							Usage:       "Organization or user that owns the GitHub repository",
 							Destination: &owner,
 						},
+						yesFlag(&selectedYes),
 					},
 					Action: func(c *cli.Context) error {
 						if len(owner) > 0 {
 							if len(repository) > 0 {
-								req := EnableRepoRequest{
+								req := client.EnableRepoRequest{
 									Owner: owner,
 									Repo:  repository,
 								}
+								cfg := LoadDefaultConfigOrExit()
+								ce := Confirm("disable "+req.Owner+"/"+req.Repo, selectedYes, func() ([][]string, error) {
+									pi.Start()
+									defer pi.Stop()
+									return DescribeRepo(ctx, NewClient(cfg), req.Owner, req.Repo)
+								})
+								if ce != nil {
+									return confirmationExit(ce, "project "+req.Owner+"/"+req.Repo)
+								}
 								pi.Start()
-								cfg := LoadDefaultConfigOrExit(http)
-								r, e := Disable(req, http, cfg)
+								e := NewClient(cfg).Disable(ctx, req)
 								pi.Stop()
 								if e != nil {
-									return cli.NewExitError("Unable to disable project "+req.Owner+"/"+req.Repo+". Response was:\n"+r, 1)
+									return commandError(e, "Unable to disable project "+req.Owner+"/"+req.Repo+".", 1)
 								} else {
-									fmt.Println(r)
+									RenderMessage("", "The project "+req.Owner+"/"+req.Repo+" has been disabled.")
 								}
 							} else {
 								return cli.NewExitError("You must supply a --repository or --repo or -r argument to specify the repository", 1)
@@ -495,13 +774,13 @@ func main() {
 						}
 
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						us, errs := ListUnits(selectedDatacenter, selectedNamespace, selectedStatus, http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						us, errs := NewClient(cfg).ListUnits(ctx, selectedDatacenter, selectedNamespace, selectedStatus)
 						pi.Stop()
 						if errs != nil {
-							return cli.NewExitError("Unable to list units", 1)
+							return commandError(errs, "Unable to list units", 1)
 						} else {
-							PrintListUnits(us)
+							RenderRows(&us, func() { PrintListUnits(us) })
 						}
 						return nil
 					},
@@ -533,27 +812,23 @@ func main() {
 						if len(selectedUnitPrefix) > 0 && len(selectedVersion) > 0 {
 							match, _ := regexp.MatchString("(\\d+)\\.(\\d+).(\\d+)", selectedVersion)
 							if match == true {
-								req := CommitRequest{
+								req := client.CommitRequest{
 									UnitName: selectedUnitPrefix,
 									Version:  selectedVersion,
 									Target:   selectedNamespace,
 								}
 
 								pi.Start()
-								cfg := LoadDefaultConfigOrExit(http)
-								r, e := CommitUnit(req, http, cfg)
+								cfg := LoadDefaultConfigOrExit()
+								e := NewClient(cfg).CommitUnit(ctx, req)
 								pi.Stop()
 
 								unitWithVersion := selectedUnitPrefix + "@" + selectedVersion
 
 								if e != nil {
-									errors := ""
-									for _, ee := range e {
-										errors += fmt.Sprintf("%s\n", ee.Error())
-									}
-									return cli.NewExitError(fmt.Sprintf("Unable to commit %s to '%s'. Response was:\n%s\nErrors:\n%s", unitWithVersion, selectedNamespace, r, errors), 1)
+									return commandError(e, fmt.Sprintf("Unable to commit %s to '%s'.", unitWithVersion, selectedNamespace), 1)
 								} else {
-									fmt.Println("===>> Commited " + unitWithVersion + " to '" + selectedNamespace + "'.")
+									RenderMessage("===>> ", "Committed "+unitWithVersion+" to '"+selectedNamespace+"'.")
 								}
 							} else {
 								return cli.NewExitError("You must supply a version of the format XXX.XXX.XXX, e.g. 2.3.4, 4.56.6, 1.7.9", 1)
@@ -564,11 +839,121 @@ func main() {
 						return nil
 					},
 				},
+				{
+					Name:  "promote",
+					Usage: "Commit a unit@version to several namespaces in turn, waiting for each to be ready and healthy before moving on",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:        "unit, u",
+							Usage:       "The unit you want to promote.",
+							Destination: &selectedUnitPrefix,
+						},
+						cli.StringFlag{
+							Name:        "version, v",
+							Usage:       "The version you want to promote. For example 1.2.3 or 5.3.12",
+							Destination: &selectedVersion,
+						},
+						cli.StringFlag{
+							Name:        "through",
+							Usage:       "Comma delimited namespaces to commit to, in order, e.g. qa,prod",
+							Destination: &selectedThrough,
+						},
+						cli.DurationFlag{
+							Name:        "gate-timeout",
+							Value:       15 * time.Minute,
+							Usage:       "How long each namespace may take to pass every gate",
+							Destination: &selectedWaitTimeout,
+						},
+						cli.DurationFlag{
+							Name:        "interval",
+							Value:       5 * time.Second,
+							Usage:       "How often to poll nelson while waiting",
+							Destination: &selectedInterval,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if len(selectedUnitPrefix) == 0 || len(selectedVersion) == 0 || len(selectedThrough) == 0 {
+							return cli.NewExitError("You must specify --unit, --version and --through.", 1)
+						}
+						if match, _ := regexp.MatchString(`^\d+\.\d+\.\d+$`, selectedVersion); !match {
+							return cli.NewExitError("You must supply a version of the format XXX.XXX.XXX, e.g. 2.3.4, 4.56.6, 1.7.9", 1)
+						}
+						namespaces := []string{}
+						for _, ns := range strings.Split(selectedThrough, ",") {
+							if ns = strings.TrimSpace(ns); len(ns) > 0 {
+								namespaces = append(namespaces, ns)
+							}
+						}
+						if len(namespaces) == 0 {
+							return cli.NewExitError("--through must name at least one namespace, e.g. qa,prod", 1)
+						}
+
+						cfg := LoadDefaultConfigOrExit()
+						report, e := PromoteUnit(ctx, NewClient(cfg), selectedUnitPrefix, selectedVersion, namespaces, selectedWaitTimeout, selectedInterval, func(msg string) {
+							if !isStructuredOutput() {
+								fmt.Println("===>> " + msg)
+							}
+						})
+						if e == client.ErrDryRun {
+							return endDryRun()
+						}
+						if e != nil {
+							PrintTerminalError(e)
+						}
+						Render(report, func() { PrintPromotionReport(report) })
+						if e != nil {
+							last := report.Namespaces[len(report.Namespaces)-1]
+							return cli.NewExitError("Promotion of "+selectedUnitPrefix+"@"+selectedVersion+" stopped at the "+last.Gate+" gate in '"+last.Namespace+"'.", 1)
+						}
+						return nil
+					},
+				},
 				{
 					Name:  "inspect",
 					Usage: "Display details about a logical unit",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:        "datacenters, d",
+							Value:       "",
+							Usage:       "Restrict the view to particular datacenters. Defaults to all of them",
+							Destination: &selectedDatacenter,
+						},
+						cli.StringFlag{
+							Name:        "namespaces, ns, n",
+							Value:       "",
+							Usage:       "Restrict the view to particular namespaces. Defaults to all of them",
+							Destination: &selectedNamespace,
+						},
+						cli.IntFlag{
+							Name:        "concurrency",
+							Value:       4,
+							Usage:       "How many stacks to inspect at once",
+							Destination: &selectedConcurrency,
+						},
+					},
 					Action: func(c *cli.Context) error {
-						fmt.Println("Currently not implemented.")
+						unit := c.Args().First()
+						if len(unit) == 0 {
+							return cli.NewExitError("You must specify the name of the unit to inspect.", 1)
+						}
+						if len(selectedDatacenter) > 0 && !isValidCommaDelimitedList(selectedDatacenter) {
+							return cli.NewExitError("You supplied an argument for 'datacenters' but it was not a valid comma-delimited list.", 1)
+						}
+						if len(selectedNamespace) > 0 && !isValidCommaDelimitedList(selectedNamespace) {
+							return cli.NewExitError("You supplied an argument for 'namespaces' but it was not a valid comma-delimited list.", 1)
+						}
+						if selectedConcurrency < 1 {
+							return cli.NewExitError("--concurrency must be at least 1.", 1)
+						}
+
+						pi.Start()
+						cfg := LoadDefaultConfigOrExit()
+						r, e := InspectUnit(ctx, NewClient(cfg), unit, selectedDatacenter, selectedNamespace, selectedConcurrency)
+						pi.Stop()
+						if e != nil {
+							return commandError(e, "Unable to inspect unit '"+unit+"'.", 1)
+						}
+						Render(r, func() { PrintInspectUnit(r) })
 						return nil
 					},
 				},
@@ -593,6 +978,7 @@ func main() {
 							Usage:       "The feature version series you want to deprecate",
 							Destination: &selectedVersion,
 						},
+						yesFlag(&selectedYes),
 					},
 					Action: func(c *cli.Context) error {
 						if len(selectedUnitPrefix) > 0 && len(selectedVersion) > 0 {
@@ -601,31 +987,41 @@ func main() {
 								splitVersion := strings.Split(selectedVersion, ".")
 								mjr, _ := strconv.Atoi(splitVersion[0])
 								min, _ := strconv.Atoi(splitVersion[1])
-								ver := FeatureVersion{
+								ver := client.FeatureVersion{
 									Major: mjr,
 									Minor: min,
 								}
-								req := DeprecationExpiryRequest{
+								req := client.DeprecationExpiryRequest{
 									ServiceType: selectedUnitPrefix,
 									Version:     ver,
 								}
+								cfg := LoadDefaultConfigOrExit()
+								if selectedNoGrace {
+									ce := Confirm("deprecate and immediately expire "+selectedUnitPrefix+" "+selectedVersion, selectedYes, func() ([][]string, error) {
+										pi.Start()
+										defer pi.Stop()
+										return DescribeUnitVersion(ctx, NewClient(cfg), selectedUnitPrefix, ver)
+									})
+									if ce != nil {
+										return confirmationExit(ce, "unit "+selectedUnitPrefix)
+									}
+								}
 								pi.Start()
-								cfg := LoadDefaultConfigOrExit(http)
-								r, e := Deprecate(req, http, cfg)
+								e := NewClient(cfg).Deprecate(ctx, req)
 								pi.Stop()
 
 								if e != nil {
-									return cli.NewExitError("Unable to deprecate unit+version series. Response was:\n"+r, 1)
+									return commandError(e, "Unable to deprecate unit+version series.", 1)
 								} else {
 									if selectedNoGrace == true {
-										_, e2 := Expire(req, http, cfg)
+										e2 := NewClient(cfg).Expire(ctx, req)
 										if e2 != nil {
-											return cli.NewExitError("Unable to deprecate unit+version series. Response was:\n"+r, 1)
+											return commandError(e2, "Unable to expire unit+version series.", 1)
 										} else {
-											fmt.Println("===>> Deprecated and expired " + selectedUnitPrefix + " " + selectedVersion)
+											RenderMessage("===>> ", "Deprecated and expired "+selectedUnitPrefix+" "+selectedVersion)
 										}
 									} else {
-										fmt.Println("===>> Deprecated " + selectedUnitPrefix + " " + selectedVersion)
+										RenderMessage("===>> ", "Deprecated "+selectedUnitPrefix+" "+selectedVersion)
 									}
 								}
 							} else {
@@ -694,14 +1090,13 @@ func main() {
 						}
 
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						r, e := ListStacks(selectedDatacenter, selectedNamespace, selectedStatus, selectedUnit, http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						r, e := NewClient(cfg).ListStacks(ctx, selectedDatacenter, selectedNamespace, selectedStatus, selectedUnit)
 						pi.Stop()
 						if e != nil {
-							PrintTerminalErrors(e)
-							return cli.NewExitError("Unable to list stacks.", 1)
+							return commandError(e, "Unable to list stacks.", 1)
 						} else {
-							PrintListStacks(r)
+							RenderRows(&r, func() { PrintListStacks(r) })
 						}
 						return nil
 					},
@@ -709,21 +1104,28 @@ func main() {
 				{
 					Name:  "inspect",
 					Usage: "Display the current status and details about a specific stack",
+					Flags: []cli.Flag{
+						stackNamespaceFlag(&selectedNamespace),
+					},
 					Action: func(c *cli.Context) error {
-						guid := c.Args().First()
-						if len(guid) > 0 && isValidGUID(guid) {
+						ref := c.Args().First()
+						if len(ref) > 0 {
 							pi.Start()
-							cfg := LoadDefaultConfigOrExit(http)
-							r, e := InspectStack(guid, http, cfg)
+							cfg := LoadDefaultConfigOrExit()
+							guid, re := ResolveStack(ctx, NewClient(cfg), ref, selectedNamespace)
+							if re != nil {
+								pi.Stop()
+								return resolutionExit(re, ref)
+							}
+							r, e := NewClient(cfg).InspectStack(ctx, guid)
 							pi.Stop()
 							if e != nil {
-								PrintTerminalErrors(e)
-								return cli.NewExitError("Unable to inspect stacks '"+guid+"'.", 1)
+								return commandError(e, "Unable to inspect stacks '"+guid+"'.", 1)
 							} else {
-								PrintInspectStack(r)
+								Render(r, func() { PrintInspectStack(r) })
 							}
 						} else {
-							return cli.NewExitError("You must supply a valid GUID for the stack you want to inspect.", 1)
+							return cli.NewExitError("You must supply the GUID, name or unit@version of the stack you want to inspect.", 1)
 						}
 						return nil
 					},
@@ -731,65 +1133,437 @@ func main() {
 				{
 					Name:  "runtime",
 					Usage: "Display the runtime status for a particular stack",
+					Flags: []cli.Flag{
+						stackNamespaceFlag(&selectedNamespace),
+					},
 					Action: func(c *cli.Context) error {
-						guid := c.Args().First()
-						if isValidGUID(guid) {
+						ref := c.Args().First()
+						if len(ref) > 0 {
 							pi.Start()
-							cfg := LoadDefaultConfigOrExit(http)
-							r, e := GetStackRuntime(guid, http, cfg)
+							cfg := LoadDefaultConfigOrExit()
+							guid, re := ResolveStack(ctx, NewClient(cfg), ref, selectedNamespace)
+							if re != nil {
+								pi.Stop()
+								return resolutionExit(re, ref)
+							}
+							r, e := NewClient(cfg).GetStackRuntime(ctx, guid)
 							pi.Stop()
 							if e != nil {
-								PrintTerminalErrors(e)
-								return cli.NewExitError("Unable to fetch runtime status.", 1)
+								return commandError(e, "Unable to fetch runtime status.", 1)
 							} else {
-								PrintStackRuntime(r)
+								Render(r, func() { PrintStackRuntime(r) })
+							}
+						} else {
+							return cli.NewExitError("You must specify the GUID, name or unit@version of a stack in order to display its runtime status.", 1)
+						}
+						return nil
+					},
+				},
+				{
+					Name:  "wait",
+					Usage: "Block until a stack reaches a given status; exits 2 if it settles on another terminal status and 3 on timeout",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:        "for",
+							Value:       "ready",
+							Usage:       "The status to wait for",
+							Destination: &selectedStatus,
+						},
+						cli.DurationFlag{
+							Name:        "timeout",
+							Value:       15 * time.Minute,
+							Usage:       "Give up after this long",
+							Destination: &selectedWaitTimeout,
+						},
+						stackNamespaceFlag(&selectedNamespace),
+					},
+					Action: func(c *cli.Context) error {
+						ref := c.Args().First()
+						if len(ref) == 0 {
+							return cli.NewExitError("You must specify the GUID, name or unit@version of a stack in order to wait for it.", 1)
+						}
+						if !isKnownStackStatus(selectedStatus) {
+							return cli.NewExitError("Unknown status '"+selectedStatus+"'; must be one of: "+strings.Join(knownStackStatuses, ", "), 1)
+						}
+						cfg := LoadDefaultConfigOrExit()
+						guid, re := ResolveStack(ctx, NewClient(cfg), ref, selectedNamespace)
+						if re != nil {
+							return resolutionExit(re, ref)
+						}
+						wctx, cancel := context.WithTimeout(ctx, selectedWaitTimeout)
+						defer cancel()
+
+						status, e := WaitForStack(wctx, NewClient(cfg), guid, selectedStatus, 2*time.Second, 30*time.Second, func(s client.StackStatus) {
+							Render(s, func() { PrintStackStatus(s) })
+						})
+						if wctx.Err() == context.DeadlineExceeded {
+							return cli.NewExitError("Timed out after "+selectedWaitTimeout.String()+" waiting for stack '"+guid+"' to become "+selectedStatus+".", 3)
+						}
+						if e != nil {
+							return commandError(e, "Unable to wait for stack '"+guid+"'.", 1)
+						}
+						if status != selectedStatus {
+							return cli.NewExitError("Stack '"+guid+"' is "+status+", not "+selectedStatus+".", 2)
+						}
+						if !isStructuredOutput() {
+							fmt.Println("===>> stack " + guid + " is " + status)
+						}
+						return nil
+					},
+				},
+				{
+					Name:  "expiring",
+					Usage: "List stacks that will expire within a window, exiting 2 if there are any",
+					Flags: []cli.Flag{
+						cli.DurationFlag{
+							Name:        "within, w",
+							Value:       48 * time.Hour,
+							Usage:       "How far ahead to look for expirations, e.g. 48h",
+							Destination: &selectedDuration,
+						},
+						cli.StringFlag{
+							Name:        "unit, u",
+							Value:       "",
+							Usage:       "Only consider stacks of the specified unit",
+							Destination: &selectedUnit,
+						},
+						cli.StringFlag{
+							Name:        "datacenters, d",
+							Value:       "",
+							Usage:       "Restrict to particular datacenters",
+							Destination: &selectedDatacenter,
+						},
+						cli.StringFlag{
+							Name:        "namespaces, ns, n",
+							Value:       "",
+							Usage:       "Restrict to particular namespaces. Defaults to 'dev,qa,prod'",
+							Destination: &selectedNamespace,
+						},
+						cli.IntFlag{
+							Name:        "concurrency",
+							Value:       4,
+							Usage:       "How many stacks to inspect at once",
+							Destination: &selectedConcurrency,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if len(selectedDatacenter) > 0 && !isValidCommaDelimitedList(selectedDatacenter) {
+							return cli.NewExitError("You supplied an argument for 'datacenters' but it was not a valid comma-delimited list.", 1)
+						}
+						if len(selectedNamespace) > 0 && !isValidCommaDelimitedList(selectedNamespace) {
+							return cli.NewExitError("You supplied an argument for 'namespaces' but it was not a valid comma-delimited list.", 1)
+						}
+						if selectedDuration <= 0 {
+							return cli.NewExitError("--within must be a positive duration, e.g. 48h.", 1)
+						}
+						if selectedConcurrency < 1 {
+							return cli.NewExitError("--concurrency must be at least 1.", 1)
+						}
+						pi.Start()
+						cfg := LoadDefaultConfigOrExit()
+						r, e := FindExpiringStacks(ctx, NewClient(cfg), selectedDatacenter, selectedNamespace, selectedUnit, selectedDuration, selectedConcurrency)
+						pi.Stop()
+						if e != nil {
+							return commandError(e, "Unable to determine which stacks are expiring.", 1)
+						}
+						RenderRows(&r, func() { PrintExpiringStacks(r, selectedDuration) })
+						if len(r) > 0 {
+							return cli.NewExitError(fmt.Sprintf("%d stack(s) expire within %s.", len(r), selectedDuration), 2)
+						}
+						return nil
+					},
+				},
+				{
+					Name:      "timeline",
+					Usage:     "Show how long a stack spent in each phase of its deployment, or compare several stacks",
+					ArgsUsage: "[stack...]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:        "unit, u",
+							Value:       "",
+							Usage:       "Compare the most recent stacks of this unit instead of naming stacks",
+							Destination: &selectedUnit,
+						},
+						cli.IntFlag{
+							Name:        "last",
+							Value:       5,
+							Usage:       "How many of the unit's most recent stacks to compare",
+							Destination: &selectedLast,
+						},
+						cli.DurationFlag{
+							Name:        "gap",
+							Value:       5 * time.Minute,
+							Usage:       "Report stretches at least this long without any status updates; 0 to disable",
+							Destination: &selectedGap,
+						},
+						stackNamespaceFlag(&selectedNamespace),
+					},
+					Action: func(c *cli.Context) error {
+						refs := []string(c.Args())
+						if len(refs) > 0 && len(selectedUnit) > 0 {
+							return cli.NewExitError("Specify either stacks to show, or --unit to compare its most recent stacks; not both.", 1)
+						}
+						if len(refs) == 0 && len(selectedUnit) == 0 {
+							return cli.NewExitError("You must specify the GUID, name or unit@version of one or more stacks, or --unit.", 1)
+						}
+						if selectedLast < 1 {
+							return cli.NewExitError("--last must be at least 1.", 1)
+						}
+						pi.Start()
+						cfg := LoadDefaultConfigOrExit()
+						guids := []string{}
+						for _, ref := range refs {
+							guid, re := ResolveStack(ctx, NewClient(cfg), ref, selectedNamespace)
+							if re != nil {
+								pi.Stop()
+								return resolutionExit(re, ref)
 							}
+							guids = append(guids, guid)
+						}
+						if len(selectedUnit) > 0 {
+							r, e := RecentStacksOfUnit(ctx, NewClient(cfg), selectedUnit, selectedNamespace, selectedLast)
+							if e != nil {
+								pi.Stop()
+								return commandError(e, "Unable to list the stacks of unit '"+selectedUnit+"'.", 1)
+							}
+							if len(r) == 0 {
+								pi.Stop()
+								return cli.NewExitError("Unit '"+selectedUnit+"' has no stacks to compare.", 1)
+							}
+							guids = r
+						}
+						ts, e := StackTimelines(ctx, NewClient(cfg), guids, selectedGap)
+						pi.Stop()
+						if e != nil {
+							return commandError(e, "Unable to build the timeline.", 1)
+						}
+						if len(ts) == 1 {
+							Render(ts[0], func() { PrintStackTimeline(ts[0]) })
 						} else {
-							return cli.NewExitError("You must specify a valid GUID reference in order to display runtime status of a stack.", 1)
+							Render(ts, func() { PrintTimelineComparison(ts) })
+						}
+						return nil
+					},
+				},
+				{
+					Name:  "graph",
+					Usage: "Export the dependency graph around a stack as dot, mermaid or json",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:        "depth",
+							Value:       1,
+							Usage:       "How many hops of dependencies to follow",
+							Destination: &selectedDepth,
+						},
+						cli.StringFlag{
+							Name:        "format",
+							Value:       GraphFormatDot,
+							Usage:       "Graph format: dot, mermaid or json",
+							Destination: &selectedGraphFormat,
+						},
+						cli.IntFlag{
+							Name:        "concurrency",
+							Value:       4,
+							Usage:       "How many stacks to inspect at once",
+							Destination: &selectedConcurrency,
+						},
+						stackNamespaceFlag(&selectedNamespace),
+					},
+					Action: func(c *cli.Context) error {
+						ref := c.Args().First()
+						if len(ref) == 0 {
+							return cli.NewExitError("You must specify the GUID, name or unit@version of a stack in order to graph it.", 1)
+						}
+						if !isValidGraphFormat(selectedGraphFormat) {
+							return cli.NewExitError("Unknown graph format '"+selectedGraphFormat+"'; must be one of: dot, mermaid, json", 1)
+						}
+						if selectedDepth < 1 {
+							return cli.NewExitError("--depth must be at least 1.", 1)
+						}
+						pi.Start()
+						cfg := LoadDefaultConfigOrExit()
+						guid, re := ResolveStack(ctx, NewClient(cfg), ref, selectedNamespace)
+						if re != nil {
+							pi.Stop()
+							return resolutionExit(re, ref)
+						}
+						g, e := BuildStackGraph(ctx, NewClient(cfg), guid, selectedDepth, selectedConcurrency)
+						pi.Stop()
+						if e != nil {
+							return commandError(e, "Unable to build the dependency graph for stack '"+guid+"'.", 1)
+						}
+						switch selectedGraphFormat {
+						case GraphFormatJSON:
+							// json unless --output asks for yaml
+							Render(g, func() { renderStructured(os.Stdout, OutputJSON, g) })
+						case GraphFormatMermaid:
+							Render(g, func() { WriteGraphMermaid(os.Stdout, g) })
+						default:
+							Render(g, func() { WriteGraphDot(os.Stdout, g) })
 						}
 						return nil
 					},
 				},
 				{
 					Name:  "redeploy",
-					Usage: "Trigger a redeployment for a specific stack",
+					Usage: "Trigger a redeployment for a specific stack, or every stack matching --unit, --datacenters and --statuses",
+					Flags: append([]cli.Flag{
+						yesFlag(&selectedYes),
+						stackNamespaceFlag(&selectedNamespace),
+					}, bulkFlags(&selectedBulk)...),
 					Action: func(c *cli.Context) error {
-						guid := c.Args().First()
-						if isValidGUID(guid) {
+						ref := c.Args().First()
+						if len(ref) > 0 && selectedBulk.hasSelector() {
+							return cli.NewExitError("Specify either a single stack, or --unit, --datacenters and --statuses to select several; not both.", 1)
+						}
+						if len(ref) == 0 && selectedBulk.hasSelector() {
+							selectedBulk.Namespaces = selectedNamespace
+							return bulkStackAction(ctx, LoadDefaultConfigOrExit(), selectedBulk, "redeploy", selectedYes, func(ctx context.Context, c *client.Client, guid string) error {
+								return c.Redeploy(ctx, guid)
+							})
+						}
+						if len(ref) > 0 {
+							cfg := LoadDefaultConfigOrExit()
+							guid, re := ResolveStack(ctx, NewClient(cfg), ref, selectedNamespace)
+							if re != nil {
+								return resolutionExit(re, ref)
+							}
+							ce := Confirm("redeploy stack "+guid, selectedYes, func() ([][]string, error) {
+								pi.Start()
+								defer pi.Stop()
+								return DescribeStack(ctx, NewClient(cfg), guid)
+							})
+							if ce != nil {
+								return confirmationExit(ce, "stack '"+guid+"'")
+							}
 							pi.Start()
-							cfg := LoadDefaultConfigOrExit(http)
-							r, e := Redeploy(guid, http, cfg)
+							e := NewClient(cfg).Redeploy(ctx, guid)
 							pi.Stop()
 
 							if e != nil {
-								return cli.NewExitError("Unable to request a redeploy. Response was:\n"+r, 1)
+								return commandError(e, "Unable to request a redeploy.", 1)
 							} else {
-								fmt.Println("===>> " + r)
+								RenderMessage("===>> ", "Redeployment requested.")
 							}
 						} else {
-							return cli.NewExitError("You must specify a valid GUID reference in order to redeploy a stack.", 1)
+							return cli.NewExitError("You must specify the GUID, name or unit@version of a stack in order to redeploy it, or select several with --unit, --datacenters and --statuses.", 1)
 						}
 						return nil
 					},
 				},
 				{
 					Name:  "reverse",
-					Usage: "Reverse an in-progress traffic shift",
+					Usage: "Reverse an in-progress traffic shift, or those onto every stack matching --unit, --datacenters and --statuses",
+					Flags: append([]cli.Flag{
+						yesFlag(&selectedYes),
+						stackNamespaceFlag(&selectedNamespace),
+					}, bulkFlags(&selectedBulk)...),
 					Action: func(c *cli.Context) error {
-						selectedGuid := c.Args().First()
-						if len(selectedGuid) > 0 && isValidGUID(selectedGuid) {
+						ref := c.Args().First()
+						if len(ref) > 0 && selectedBulk.hasSelector() {
+							return cli.NewExitError("Specify either a single stack, or --unit, --datacenters and --statuses to select several; not both.", 1)
+						}
+						if len(ref) == 0 && selectedBulk.hasSelector() {
+							selectedBulk.Namespaces = selectedNamespace
+							return bulkStackAction(ctx, LoadDefaultConfigOrExit(), selectedBulk, "reverse", selectedYes, func(ctx context.Context, c *client.Client, guid string) error {
+								return c.ReverseTrafficShift(ctx, guid)
+							})
+						}
+						if len(ref) > 0 {
 							pi.Start()
-							cfg := LoadDefaultConfigOrExit(http)
-							res, e := ReverseTrafficShift(selectedGuid, http, cfg)
+							cfg := LoadDefaultConfigOrExit()
+							selectedGuid, re := ResolveStack(ctx, NewClient(cfg), ref, selectedNamespace)
+							if re != nil {
+								pi.Stop()
+								return resolutionExit(re, ref)
+							}
+							e := NewClient(cfg).ReverseTrafficShift(ctx, selectedGuid)
 							pi.Stop()
 							if e != nil {
-								PrintTerminalErrors(e)
-								return cli.NewExitError("Unable to reverse traffic shift.", 1)
+								return commandError(e, "Unable to reverse traffic shift.", 1)
 							} else {
-								fmt.Println(res)
+								RenderMessage("", "Traffic shift reversed.")
 							}
 						} else {
-							return cli.NewExitError("You must specify a valid stack guid for the in-progress traffic shift's target deployment.", 1)
+							return cli.NewExitError("You must specify the GUID, name or unit@version of the in-progress traffic shift's target stack, or select several with --unit, --datacenters and --statuses.", 1)
+						}
+						return nil
+					},
+				},
+				{
+					Name:  "canary",
+					Usage: "Watch the target stack of an in-progress traffic shift, and reverse the shift if it becomes unhealthy; exits 2 when it was reversed",
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:        "max-failed",
+							Usage:       "Failed instances the scheduler may report before a sample counts as unhealthy",
+							Destination: &selectedThresholds.MaxFailed,
+						},
+						cli.IntFlag{
+							Name:        "max-failing-checks",
+							Usage:       "Consul health checks that may be failing before a sample counts as unhealthy",
+							Destination: &selectedThresholds.MaxFailingChecks,
+						},
+						cli.IntFlag{
+							Name:        "breaches",
+							Value:       2,
+							Usage:       "Unhealthy samples in a row that reverse the traffic shift",
+							Destination: &selectedThresholds.Breaches,
+						},
+						cli.DurationFlag{
+							Name:        "interval",
+							Value:       30 * time.Second,
+							Usage:       "How often to sample the stack",
+							Destination: &selectedInterval,
+						},
+						cli.DurationFlag{
+							Name:        "duration",
+							Value:       10 * time.Minute,
+							Usage:       "How long to watch before declaring the canary healthy",
+							Destination: &selectedDuration,
+						},
+						stackNamespaceFlag(&selectedNamespace),
+					},
+					Action: func(c *cli.Context) error {
+						ref := c.Args().First()
+						if len(ref) == 0 {
+							return cli.NewExitError("You must specify the GUID, name or unit@version of the in-progress traffic shift's target stack.", 1)
+						}
+						if selectedThresholds.Breaches < 1 || selectedThresholds.MaxFailed < 0 || selectedThresholds.MaxFailingChecks < 0 {
+							return cli.NewExitError("--breaches must be at least 1, and the maximums cannot be negative.", 1)
+						}
+						if selectedInterval <= 0 || selectedDuration <= 0 {
+							return cli.NewExitError("--interval and --duration must be positive.", 1)
+						}
+						cfg := LoadDefaultConfigOrExit()
+						guid, re := ResolveStack(ctx, NewClient(cfg), ref, selectedNamespace)
+						if re != nil {
+							return resolutionExit(re, ref)
+						}
+
+						if !isStructuredOutput() {
+							fmt.Println("===>> watching canary " + guid + " for " + selectedDuration.String())
+						}
+						report, e := WatchCanary(ctx, NewClient(cfg), guid, selectedThresholds, selectedInterval, selectedDuration, func(s CanarySample) {
+							if !isStructuredOutput() {
+								PrintCanarySample(s)
+							}
+						})
+						if e == client.ErrDryRun {
+							return endDryRun()
+						}
+						if e != nil {
+							PrintTerminalError(e)
+							// the samples were already printed as they were taken
+							Render(report, func() {})
+							if report.Verdict == CanaryReversed {
+								return cli.NewExitError("Canary "+guid+" breached its thresholds, but the traffic shift could not be reversed.", 1)
+							}
+							return cli.NewExitError("Unable to watch canary "+guid+".", 1)
+						}
+						Render(report, func() { PrintCanaryReport(report) })
+						if report.Verdict == CanaryReversed {
+							return cli.NewExitError("", 2)
 						}
 						return nil
 					},
@@ -848,7 +1622,7 @@ func main() {
 							len(stackHash) > 0 &&
 							len(description) > 0 &&
 							selectedPort > 0 {
-							req := ManualDeploymentRequest{
+							req := client.ManualDeploymentRequest{
 								Datacenter:  selectedDatacenter,
 								Namespace:   selectedNamespace,
 								ServiceType: selectedServiceType,
@@ -858,13 +1632,13 @@ func main() {
 								Port:        selectedPort,
 							}
 							pi.Start()
-							cfg := LoadDefaultConfigOrExit(http)
-							res, e := RegisterManualDeployment(req, http, cfg)
+							cfg := LoadDefaultConfigOrExit()
+							e := NewClient(cfg).RegisterManualDeployment(ctx, req)
 							pi.Stop()
 							if e != nil {
-								return cli.NewExitError("Unable to register manual deployment.", 1)
+								return commandError(e, "Unable to register manual deployment.", 1)
 							} else {
-								fmt.Println(res)
+								RenderMessage("", "Manual stack has been registered.")
 							}
 						} else {
 							return cli.NewExitError("You must specify the following switches: \n\t--datacenter <string> \n\t--namespace <string> \n\t--service-type <string> \n\t--version <string> \n\t--hash <string> \n\t--description <string> \n\t--port <int>", 1)
@@ -876,13 +1650,67 @@ func main() {
 					Name:    "fs",
 					Aliases: []string{"logs"},
 					Usage:   "Fetch the deployment log for a given stack",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:        "follow, f",
+							Usage:       "Keep streaming new log lines until the stack reaches a terminal status",
+							Destination: &selectedFollow,
+						},
+						cli.IntFlag{
+							Name:        "since-offset",
+							Usage:       "Only show log lines from this offset onwards",
+							Destination: &selectedOffset,
+						},
+						cli.IntFlag{
+							Name:        "tail",
+							Usage:       "Only show the last N lines of the existing log",
+							Destination: &selectedTail,
+						},
+						cli.DurationFlag{
+							Name:        "interval",
+							Value:       2 * time.Second,
+							Usage:       "How often to poll for new lines when following",
+							Destination: &selectedInterval,
+						},
+						stackNamespaceFlag(&selectedNamespace),
+					},
 					Action: func(c *cli.Context) error {
-						guid := c.Args().First()
-						if len(guid) > 0 && isValidGUID(guid) {
-							cfg := LoadDefaultConfigOrExit(http)
-							GetDeploymentLog(guid, http, cfg)
+						ref := c.Args().First()
+						if len(ref) > 0 {
+							if selectedOffset < 0 || selectedTail < 0 {
+								return cli.NewExitError("--since-offset and --tail must not be negative.", 1)
+							}
+							cfg := LoadDefaultConfigOrExit()
+							guid, re := ResolveStack(ctx, NewClient(cfg), ref, selectedNamespace)
+							if re != nil {
+								return resolutionExit(re, ref)
+							}
+							if selectedFollow {
+								if !isStructuredOutput() {
+									fmt.Println("===>> logs for stack " + guid)
+								}
+								status, e := FollowDeploymentLog(ctx, NewClient(cfg), guid, selectedOffset, selectedTail, selectedInterval, func(logs client.StackLog) {
+									Render(logs, func() {
+										for _, l := range logs.Content {
+											fmt.Println(l)
+										}
+									})
+								})
+								if e != nil {
+									return commandError(e, "Unable to follow the deployment log for stack '"+guid+"'.", 1)
+								}
+								if !isStructuredOutput() {
+									fmt.Println("===>> stack " + guid + " is " + status)
+								}
+								return nil
+							}
+							logs, e := FetchDeploymentLog(ctx, NewClient(cfg), guid, selectedOffset, selectedTail)
+							if e != nil {
+								return commandError(e, "Unable to fetch the deployment log for stack '"+guid+"'.", 1)
+							}
+							Render(logs, func() { PrintDeploymentLog(guid, logs) })
 						} else {
-							return cli.NewExitError("You must specify a valid GUID for the stack you wish to view logs for.", 1)
+							return cli.NewExitError("You must specify the GUID, name or unit@version of the stack you wish to view logs for.", 1)
 						}
 						return nil
 					},
@@ -899,14 +1727,13 @@ func main() {
 					Usage: "list the available cleanup policies",
 					Action: func(c *cli.Context) error {
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						policies, e := ListCleanupPolicies(http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						policies, e := NewClient(cfg).ListCleanupPolicies(ctx)
 						pi.Stop()
 						if e != nil {
-							PrintTerminalErrors(e)
-							return cli.NewExitError("Unable to list the cleanup policies at this time.", 1)
+							return commandError(e, "Unable to list the cleanup policies at this time.", 1)
 						} else {
-							PrintCleanupPolicies(policies)
+							RenderRows(&policies, func() { PrintCleanupPolicies(policies) })
 						}
 						return nil
 					},
@@ -916,15 +1743,16 @@ func main() {
 					Usage: "Ask for info about the current Nelson build",
 					Action: func(c *cli.Context) error {
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						sr, e := WhoAreYou(http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						sr, e := NewClient(cfg).WhoAreYou(ctx)
 						pi.Stop()
 						if e != nil {
-							PrintTerminalErrors(e)
-							return cli.NewExitError("Unable to fetch build info for Nelson.", 1)
+							return commandError(e, "Unable to fetch build info for Nelson.", 1)
 						} else {
-							fmt.Println(sr.Banner)
-							fmt.Println(" " + cfg.Endpoint)
+							Render(sr, func() {
+								fmt.Println(sr.Banner)
+								fmt.Println(" " + cfg.Endpoint)
+							})
 						}
 						return nil
 					},
@@ -937,14 +1765,23 @@ func main() {
 			Usage: "Ask nelson who you are currently logged in as",
 			Action: func(c *cli.Context) error {
 				pi.Start()
-				cfg := LoadDefaultConfigOrExit(http)
-				sr, e := WhoAmI(http, cfg)
+				cfg := LoadDefaultConfigOrExit()
+				sr, e := NewClient(cfg).WhoAmI(ctx)
 				pi.Stop()
 				if e != nil {
-					PrintTerminalErrors(e)
-					return cli.NewExitError("Unable to determine who is currently logged into Nelson.", 1)
+					return commandError(e, "Unable to determine who is currently logged into Nelson.", 1)
 				} else {
-					fmt.Println("===>> Currently logged in to " + sr.User.Name + " @ " + cfg.Endpoint)
+					report := WhoAmIReport{
+						User:      sr.User,
+						Endpoint:  cfg.Endpoint,
+						Source:    cfg.source,
+						Context:   cfg.contextName,
+						ExpiresAt: cfg.ExpiresAt,
+					}
+					if cfg.ExpiresAt > 0 {
+						report.ExpiresInSeconds = int64(cfg.ExpiresIn().Seconds())
+					}
+					Render(report, func() { PrintWhoAmI(report) })
 				}
 				return nil
 			},
@@ -987,13 +1824,13 @@ func main() {
 						}
 
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						us, errs := ListLoadbalancers(selectedDatacenter, selectedNamespace, selectedStatus, http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						us, errs := NewClient(cfg).ListLoadbalancers(ctx, selectedDatacenter, selectedNamespace)
 						pi.Stop()
 						if errs != nil {
-							return cli.NewExitError("Unable to list load balancers right now. Sorry!", 1)
+							return commandError(errs, "Unable to list load balancers right now. Sorry!", 1)
 						} else {
-							PrintListLoadbalancers(us)
+							RenderRows(&us, func() { PrintListLoadbalancers(us) })
 						}
 						return nil
 					},
@@ -1001,18 +1838,28 @@ func main() {
 				{
 					Name:  "down",
 					Usage: "remove the specified load balancer",
+					Flags: []cli.Flag{
+						yesFlag(&selectedYes),
+					},
 					Action: func(c *cli.Context) error {
 						guid := c.Args().First()
 						if len(guid) > 0 && isValidGUID(guid) {
+							cfg := LoadDefaultConfigOrExit()
+							ce := Confirm("remove load balancer "+guid, selectedYes, func() ([][]string, error) {
+								pi.Start()
+								defer pi.Stop()
+								return DescribeLoadbalancer(ctx, NewClient(cfg), guid)
+							})
+							if ce != nil {
+								return confirmationExit(ce, "loadbalancer '"+guid+"'")
+							}
 							pi.Start()
-							cfg := LoadDefaultConfigOrExit(http)
-							r, e := RemoveLoadBalancer(guid, http, cfg)
+							e := NewClient(cfg).RemoveLoadBalancer(ctx, guid)
 							pi.Stop()
 							if e != nil {
-								PrintTerminalErrors(e)
-								return cli.NewExitError("Unable to remove loadbalancer '"+guid+"'.", 1)
+								return commandError(e, "Unable to remove loadbalancer '"+guid+"'.", 1)
 							} else {
-								fmt.Println("==>>> " + r)
+								RenderMessage("==>>> ", "Requested removal of "+guid)
 							}
 						} else {
 							return cli.NewExitError("You must supply a valid GUID for the loadbalancer you want to remove.", 1)
@@ -1060,7 +1907,7 @@ func main() {
 								return cli.NewExitError("The specified major version does not look like an integer value.", 1)
 							}
 
-							req := LoadbalancerCreate{
+							req := client.LoadbalancerCreate{
 								Name:         selectedUnitPrefix,
 								MajorVersion: int(mjver),
 								Datacenter:   selectedDatacenter,
@@ -1068,14 +1915,13 @@ func main() {
 							}
 
 							pi.Start()
-							cfg := LoadDefaultConfigOrExit(http)
-							res, e := CreateLoadBalancer(req, http, cfg)
+							cfg := LoadDefaultConfigOrExit()
+							e := NewClient(cfg).CreateLoadBalancer(ctx, req)
 							pi.Stop()
 							if e != nil {
-								PrintTerminalErrors(e)
-								return cli.NewExitError("Unable to launch the specified loadbalancer.", 1)
+								return commandError(e, "Unable to launch the specified loadbalancer.", 1)
 							} else {
-								fmt.Println(res)
+								RenderMessage("", "Loadbalancer has been created.")
 							}
 						} else {
 							return cli.NewExitError("You must specify the following switches: \n\t--datacenter <string> \n\t--namespace <string> \n\t--major-version <int> \n\t--name <string>", 1)
@@ -1092,14 +1938,13 @@ func main() {
 							return cli.NewExitError("you must specify a loadbalancer guid as the first argument", 1)
 						}
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						lb, e := InspectLoadBalancer(selectedLoadbalancer, http, cfg)
+						cfg := LoadDefaultConfigOrExit()
+						lb, e := NewClient(cfg).InspectLoadBalancer(ctx, selectedLoadbalancer)
 						pi.Stop()
 						if e != nil {
-							PrintTerminalErrors(e)
-							return cli.NewExitError("Unable to inspect loadbalancer right now, Sorry!", 1)
+							return commandError(e, "Unable to inspect loadbalancer right now, Sorry!", 1)
 						} else {
-							PrintInspectLoadbalancer(lb)
+							Render(lb, func() { PrintInspectLoadbalancer(lb) })
 						}
 						return nil
 					},
@@ -1132,19 +1977,18 @@ func main() {
 						if len(selectedDatacenter) > 0 &&
 							len(selectedNamespace) > 0 {
 
-							req := NamespaceRequest{
+							req := client.NamespaceRequest{
 								Namespace: selectedNamespace,
 							}
 
 							pi.Start()
-							cfg := LoadDefaultConfigOrExit(http)
-							res, e := CreateNamespace(req, selectedDatacenter, http, cfg)
+							cfg := LoadDefaultConfigOrExit()
+							e := NewClient(cfg).CreateNamespace(ctx, req, selectedDatacenter)
 							pi.Stop()
 							if e != nil {
-								PrintTerminalErrors(e)
-								return cli.NewExitError("Unable to create the specified namespace.", 1)
+								return commandError(e, "Unable to create the specified namespace.", 1)
 							} else {
-								fmt.Println(res)
+								RenderMessage("", "namespace(s) has been created.")
 							}
 						} else {
 							return cli.NewExitError("You must specify the following switches: \n\t--datacenter <string> \n\t--namespace <string>", 1)
@@ -1173,6 +2017,11 @@ func main() {
 							Usage:       "The Nelson manifest file to validate",
 							Destination: &selectedManifest,
 						},
+						cli.BoolFlag{
+							Name:        "offline",
+							Usage:       "Only run the local checks, without contacting Nelson",
+							Destination: &selectedOffline,
+						},
 					},
 					Action: func(c *cli.Context) error {
 						if len(selectedManifest) <= 0 {
@@ -1182,33 +2031,48 @@ func main() {
 						if err != nil {
 							return cli.NewExitError("Could not read "+selectedManifest, 1)
 						}
+
+						diags := LintManifestOffline(selectedManifest, manifest)
+						if selectedOffline || hasManifestErrors(diags) {
+							Render(diags, func() { PrintManifestDiagnostics(diags) })
+							if hasManifestErrors(diags) {
+								return cli.NewExitError("Manifest validation failed.", 1)
+							}
+							if !isStructuredOutput() {
+								fmt.Println("Nelson manifest passed the local checks.")
+							}
+							return nil
+						}
+						if !isStructuredOutput() {
+							PrintManifestDiagnostics(diags)
+						}
+
 						manifestBase64 := base64.StdEncoding.EncodeToString(manifest)
 						var unitNames []string = c.StringSlice("unit")
-						var manifestUnits []ManifestUnit = []ManifestUnit{}
+						var manifestUnits []client.ManifestUnit = []client.ManifestUnit{}
 						for i := 0; i < len(unitNames); i++ {
 							var n string = unitNames[i]
 							manifestUnits = append(
 								manifestUnits,
-								ManifestUnit{
+								client.ManifestUnit{
 									Name: n,
 									Kind: n,
 								},
 							)
 						}
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						req := LintManifestRequest{
+						cfg := LoadDefaultConfigOrExit()
+						req := client.LintManifestRequest{
 							Units:    manifestUnits,
 							Manifest: manifestBase64,
 						}
-						msg, errs := LintManifest(req, http, cfg)
+						msg, errs := NewClient(cfg).LintManifest(ctx, req)
 						pi.Stop()
 						if errs != nil {
-							PrintTerminalErrors(errs)
-							fmt.Println(msg)
+							RenderFailure(errs, msg)
 							return cli.NewExitError("Manifest validation failed.", 1)
 						} else {
-							fmt.Println(msg)
+							RenderMessage("", "Nelson manifest validated with no errors.")
 						}
 						return nil
 					},
@@ -1249,20 +2113,19 @@ func main() {
 						templateBase64 := base64.StdEncoding.EncodeToString(template)
 
 						pi.Start()
-						cfg := LoadDefaultConfigOrExit(http)
-						req := LintTemplateRequest{
+						cfg := LoadDefaultConfigOrExit()
+						req := client.LintTemplateRequest{
 							Unit:      selectedUnitPrefix,
 							Resources: c.StringSlice("resource"),
 							Template:  templateBase64,
 						}
-						msg, errs := LintTemplate(req, http, cfg)
+						msg, errs := NewClient(cfg).LintTemplate(ctx, req)
 						pi.Stop()
 						if errs != nil {
-							PrintTerminalErrors(errs)
-							fmt.Println(msg)
+							RenderFailure(errs, msg)
 							return cli.NewExitError("Template linting failed.", 1)
 						} else {
-							fmt.Println(msg)
+							RenderMessage("", "Template rendered successfully.\nRendered output discarded for security reasons.")
 						}
 						return nil
 					},
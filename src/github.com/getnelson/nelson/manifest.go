@@ -0,0 +1,606 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * {
+ *   "file": ".nelson.yml",
+ *   "line": 12,
+ *   "column": 7,
+ *   "severity": "error",
+ *   "path": "plans[0].health_checks[0].port_reference",
+ *   "message": "port reference 'http' is not a port of unit 'howdy-http'"
+ * }
+ */
+type ManifestDiagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Path     string `json:"path,omitempty"`
+	Message  string `json:"message"`
+}
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+func (d ManifestDiagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Column, d.Severity, d.Message)
+}
+
+func hasManifestErrors(diags []ManifestDiagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func PrintManifestDiagnostics(diags []ManifestDiagnostic) {
+	for _, d := range diags {
+		fmt.Println(d.String())
+	}
+}
+
+/////////////////// POSITIONS ///////////////////
+
+type manifestPosition struct {
+	Line   int
+	Column int
+}
+
+type positionFrame struct {
+	indent int
+	path   string
+	item   bool
+}
+
+var yamlKeyPattern = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s#'"\-][^:#]*?|-[^\s:#][^:#]*?)\s*:(\s|$)`)
+
+// locates the line and column of every key and list item in a YAML
+// document, keyed by paths such as "units[0].ports[1]". yaml.v2 does not
+// expose positions, so this follows the block indentation of the source;
+// flow collections are located at their parent key.
+func locateYamlPaths(src []byte) map[string]manifestPosition {
+	positions := map[string]manifestPosition{}
+	counters := map[string]int{}
+	stack := []positionFrame{}
+	blockScalar := -1
+
+	top := func() string {
+		if len(stack) == 0 {
+			return ""
+		}
+		return stack[len(stack)-1].path
+	}
+
+	for n, raw := range strings.Split(string(src), "\n") {
+		line := strings.TrimRight(raw, " \t\r")
+		content := strings.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+		if content == "" || strings.HasPrefix(content, "#") {
+			continue
+		}
+		if blockScalar >= 0 {
+			if indent > blockScalar {
+				continue
+			}
+			blockScalar = -1
+		}
+		if content == "---" || content == "..." {
+			continue
+		}
+
+		for content != "" {
+			if content == "-" || strings.HasPrefix(content, "- ") {
+				for len(stack) > 0 && (stack[len(stack)-1].indent > indent || (stack[len(stack)-1].item && stack[len(stack)-1].indent == indent)) {
+					stack = stack[:len(stack)-1]
+				}
+				parent := top()
+				path := parent + "[" + strconv.Itoa(counters[parent]) + "]"
+				counters[parent]++
+				positions[path] = manifestPosition{Line: n + 1, Column: indent + 1}
+				stack = append(stack, positionFrame{indent: indent, path: path, item: true})
+
+				rest := strings.TrimLeft(strings.TrimPrefix(content, "-"), " ")
+				indent = indent + len(content) - len(rest)
+				content = rest
+				continue
+			}
+
+			m := yamlKeyPattern.FindStringSubmatch(content)
+			if m == nil {
+				break // a plain scalar
+			}
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				stack = stack[:len(stack)-1]
+			}
+			key := strings.Trim(m[1], `"'`)
+			path := key
+			if parent := top(); parent != "" {
+				path = parent + "." + key
+			}
+			positions[path] = manifestPosition{Line: n + 1, Column: indent + 1}
+
+			value := strings.TrimSpace(content[len(m[0]):])
+			if value == "" || strings.HasPrefix(value, "#") {
+				stack = append(stack, positionFrame{indent: indent, path: path})
+			} else if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+				blockScalar = indent
+			}
+			break
+		}
+	}
+	return positions
+}
+
+// strips the last segment of a path; "a.b[1]" becomes "a.b" and "a.b"
+// becomes "a".
+func parentYamlPath(path string) string {
+	i := strings.LastIndexAny(path, ".[")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+/////////////////// LINTING ///////////////////
+
+type manifestLinter struct {
+	file      string
+	positions map[string]manifestPosition
+	diags     []ManifestDiagnostic
+}
+
+func (l *manifestLinter) report(severity string, path string, format string, args ...interface{}) {
+	p := manifestPosition{Line: 1, Column: 1}
+	for at := path; at != ""; at = parentYamlPath(at) {
+		if found, ok := l.positions[at]; ok {
+			p = found
+			break
+		}
+	}
+	l.diags = append(l.diags, ManifestDiagnostic{
+		File:     l.file,
+		Line:     p.Line,
+		Column:   p.Column,
+		Severity: severity,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *manifestLinter) errorf(path string, format string, args ...interface{}) {
+	l.report(SeverityError, path, format, args...)
+}
+
+func (l *manifestLinter) warnf(path string, format string, args ...interface{}) {
+	l.report(SeverityWarning, path, format, args...)
+}
+
+// returns the value as a mapping with string keys, reporting an error
+// if it is not one.
+func (l *manifestLinter) mapping(path string, v interface{}) (map[string]interface{}, bool) {
+	raw, ok := v.(map[interface{}]interface{})
+	if !ok {
+		l.errorf(path, "expected a mapping")
+		return nil, false
+	}
+	m := map[string]interface{}{}
+	for k, v := range raw {
+		m[fmt.Sprint(k)] = v
+	}
+	return m, true
+}
+
+// returns the list under key, reporting an error if it is not a list;
+// a missing key yields an empty list.
+func (l *manifestLinter) list(path string, m map[string]interface{}, key string) []interface{} {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return nil
+	}
+	xs, ok := v.([]interface{})
+	if !ok {
+		l.errorf(childPath(path, key), "'%s' must be a list", key)
+		return nil
+	}
+	return xs
+}
+
+// returns the non-empty string under key, reporting an error if it is
+// missing or not a string.
+func (l *manifestLinter) name(path string, m map[string]interface{}, key string) (string, bool) {
+	v, ok := m[key]
+	if !ok || v == nil {
+		l.errorf(path, "missing required field '%s'", key)
+		return "", false
+	}
+	s, ok := v.(string)
+	if !ok || s == "" {
+		l.errorf(childPath(path, key), "'%s' must be a non-empty string", key)
+		return "", false
+	}
+	return s, true
+}
+
+func childPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func itemPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+func asNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+var (
+	manifestNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+	manifestPortPattern = regexp.MustCompile(`^([a-z0-9-]+)->(\d+)/([a-z0-9]+)$`)
+	manifestDestPattern = regexp.MustCompile(`^([a-z0-9-]+)->([a-z0-9-]+)$`)
+	manifestDepPattern  = regexp.MustCompile(`^[a-z0-9-]+@\d+(\.\d+){0,2}$`)
+	yamlErrorPattern    = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+)
+
+var knownManifestSections = []string{"units", "plans", "namespaces", "loadbalancers"}
+
+// LintManifestOffline checks the structure of a Nelson manifest without
+// talking to a server: that units, plans, namespaces and load balancers
+// are well formed, and that the references between them resolve.
+// Diagnostics are ordered by position in the file.
+func LintManifestOffline(file string, src []byte) []ManifestDiagnostic {
+	l := &manifestLinter{file: file, positions: locateYamlPaths(src)}
+
+	var doc interface{}
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		d := ManifestDiagnostic{File: file, Line: 1, Column: 1, Severity: SeverityError, Message: err.Error()}
+		if m := yamlErrorPattern.FindStringSubmatch(err.Error()); m != nil {
+			d.Line, _ = strconv.Atoi(m[1])
+			d.Message = m[2]
+		}
+		return []ManifestDiagnostic{d}
+	}
+	root, ok := l.mapping("", doc)
+	if !ok {
+		return l.diags
+	}
+
+	for key := range root {
+		known := false
+		for _, s := range knownManifestSections {
+			known = known || s == key
+		}
+		if !known {
+			l.warnf(key, "unknown top-level key '%s'", key)
+		}
+	}
+	for _, key := range []string{"units", "namespaces"} {
+		if _, ok := root[key]; !ok {
+			l.errorf("", "missing required section '%s'", key)
+		}
+	}
+
+	unitPorts := l.lintUnits(root)
+	plans := l.lintPlans(root)
+	lbs := l.lintLoadbalancers(root, unitPorts)
+	l.lintNamespaces(root, unitPorts, plans, lbs)
+
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		if l.diags[i].Line != l.diags[j].Line {
+			return l.diags[i].Line < l.diags[j].Line
+		}
+		return l.diags[i].Column < l.diags[j].Column
+	})
+	return l.diags
+}
+
+// returns the port references of every unit, keyed by unit name.
+func (l *manifestLinter) lintUnits(root map[string]interface{}) map[string]map[string]bool {
+	units := map[string]map[string]bool{}
+	for i, v := range l.list("", root, "units") {
+		path := itemPath("units", i)
+		u, ok := l.mapping(path, v)
+		if !ok {
+			continue
+		}
+		name, ok := l.name(path, u, "name")
+		if !ok {
+			continue
+		}
+		if !manifestNamePattern.MatchString(name) {
+			l.errorf(childPath(path, "name"), "unit name '%s' must be lowercase letters, digits and dashes", name)
+		}
+		if _, dup := units[name]; dup {
+			l.errorf(childPath(path, "name"), "unit '%s' is declared more than once", name)
+		}
+		if _, ok := u["description"]; !ok {
+			l.warnf(path, "unit '%s' has no description", name)
+		}
+
+		ports := map[string]bool{}
+		for j, p := range l.list(path, u, "ports") {
+			ppath := itemPath(childPath(path, "ports"), j)
+			s, _ := p.(string)
+			m := manifestPortPattern.FindStringSubmatch(s)
+			if m == nil {
+				l.errorf(ppath, "port '%v' must look like <name>-><port>/<protocol>, e.g. default->8080/http", p)
+				continue
+			}
+			if n, _ := strconv.Atoi(m[2]); n < 1 || n > 65535 {
+				l.errorf(ppath, "port number %s is out of range", m[2])
+			}
+			if ports[m[1]] {
+				l.errorf(ppath, "port reference '%s' is declared more than once in unit '%s'", m[1], name)
+			}
+			ports[m[1]] = true
+		}
+
+		for j, d := range l.list(path, u, "dependencies") {
+			dpath := itemPath(childPath(path, "dependencies"), j)
+			dep, ok := l.mapping(dpath, d)
+			if !ok {
+				continue
+			}
+			if ref, ok := l.name(dpath, dep, "ref"); ok && !manifestDepPattern.MatchString(ref) {
+				l.errorf(childPath(dpath, "ref"), "dependency '%s' must look like <unit>@<version>, e.g. inventory@1.4", ref)
+			}
+		}
+		units[name] = ports
+	}
+	return units
+}
+
+// returns the health check port references of every plan, keyed by
+// plan name and then by the path of the check.
+func (l *manifestLinter) lintPlans(root map[string]interface{}) map[string]map[string]string {
+	plans := map[string]map[string]string{}
+	for i, v := range l.list("", root, "plans") {
+		path := itemPath("plans", i)
+		p, ok := l.mapping(path, v)
+		if !ok {
+			continue
+		}
+		name, ok := l.name(path, p, "name")
+		if !ok {
+			continue
+		}
+		if _, dup := plans[name]; dup {
+			l.errorf(childPath(path, "name"), "plan '%s' is declared more than once", name)
+		}
+
+		for _, key := range []string{"cpu", "memory", "cpu_request", "memory_request"} {
+			if raw, ok := p[key]; ok {
+				if n, ok := asNumber(raw); !ok || n <= 0 {
+					l.errorf(childPath(path, key), "'%s' must be a positive number", key)
+				}
+			}
+		}
+		if raw, ok := p["instances"]; ok {
+			if inst, ok := l.mapping(childPath(path, "instances"), raw); ok {
+				if d, ok := inst["desired"]; ok {
+					if n, ok := d.(int); !ok || n < 0 {
+						l.errorf(childPath(path, "instances.desired"), "'desired' must be a non-negative whole number")
+					}
+				}
+			}
+		}
+		for j, e := range l.list(path, p, "environment") {
+			if s, ok := e.(string); !ok || !strings.Contains(s, "=") {
+				l.errorf(itemPath(childPath(path, "environment"), j), "environment entries must look like KEY=value")
+			}
+		}
+
+		checks := map[string]string{}
+		for j, h := range l.list(path, p, "health_checks") {
+			hpath := itemPath(childPath(path, "health_checks"), j)
+			hc, ok := l.mapping(hpath, h)
+			if !ok {
+				continue
+			}
+			l.name(hpath, hc, "name")
+			if ref, ok := l.name(hpath, hc, "port_reference"); ok {
+				checks[childPath(hpath, "port_reference")] = ref
+			}
+			protocol, ok := l.name(hpath, hc, "protocol")
+			if !ok {
+				continue
+			}
+			switch protocol {
+			case "http", "https":
+				if _, ok := hc["path"]; !ok {
+					l.errorf(hpath, "%s health checks require a 'path'", protocol)
+				}
+			case "tcp":
+			default:
+				l.errorf(childPath(hpath, "protocol"), "health check protocol must be one of http, https or tcp, not '%s'", protocol)
+			}
+		}
+		plans[name] = checks
+	}
+	return plans
+}
+
+// returns the names of all load balancers.
+func (l *manifestLinter) lintLoadbalancers(root map[string]interface{}, units map[string]map[string]bool) map[string]bool {
+	lbs := map[string]bool{}
+	for i, v := range l.list("", root, "loadbalancers") {
+		path := itemPath("loadbalancers", i)
+		lb, ok := l.mapping(path, v)
+		if !ok {
+			continue
+		}
+		name, ok := l.name(path, lb, "name")
+		if !ok {
+			continue
+		}
+		if lbs[name] {
+			l.errorf(childPath(path, "name"), "load balancer '%s' is declared more than once", name)
+		}
+		lbs[name] = true
+
+		exposed := map[string]bool{}
+		for j, r := range l.list(path, lb, "routes") {
+			rpath := itemPath(childPath(path, "routes"), j)
+			route, ok := l.mapping(rpath, r)
+			if !ok {
+				continue
+			}
+			if expose, ok := l.name(rpath, route, "expose"); ok {
+				m := manifestPortPattern.FindStringSubmatch(expose)
+				if m == nil {
+					l.errorf(childPath(rpath, "expose"), "expose '%s' must look like <name>-><port>/<protocol>, e.g. default->8444/http", expose)
+				} else if exposed[m[2]] {
+					l.errorf(childPath(rpath, "expose"), "port %s is exposed more than once by load balancer '%s'", m[2], name)
+				} else {
+					exposed[m[2]] = true
+				}
+			}
+			if dest, ok := l.name(rpath, route, "destination"); ok {
+				m := manifestDestPattern.FindStringSubmatch(dest)
+				if m == nil {
+					l.errorf(childPath(rpath, "destination"), "destination '%s' must look like <unit>-><port reference>", dest)
+				} else if ports, ok := units[m[1]]; !ok {
+					l.errorf(childPath(rpath, "destination"), "destination unit '%s' is not declared in units", m[1])
+				} else if !ports[m[2]] {
+					l.errorf(childPath(rpath, "destination"), "port reference '%s' is not a port of unit '%s'", m[2], m[1])
+				}
+			}
+		}
+	}
+	return lbs
+}
+
+func (l *manifestLinter) lintNamespaces(root map[string]interface{}, units map[string]map[string]bool, plans map[string]map[string]string, lbs map[string]bool) {
+	namespaces := map[string]bool{}
+	usedUnits := map[string]bool{}
+	usedPlans := map[string]bool{}
+	checked := map[string]bool{}
+
+	// the plans a unit or load balancer is deployed with must exist, and
+	// their health checks must refer to ports of the unit
+	refPlans := func(path string, m map[string]interface{}, unit string) {
+		for k, pv := range l.list(path, m, "plans") {
+			ppath := itemPath(childPath(path, "plans"), k)
+			plan, _ := pv.(string)
+			checks, ok := plans[plan]
+			if !ok {
+				l.errorf(ppath, "plan '%v' is not declared in plans", pv)
+				continue
+			}
+			usedPlans[plan] = true
+			if unit == "" {
+				continue
+			}
+			for cpath, ref := range checks {
+				if !units[unit][ref] && !checked[cpath+"/"+unit] {
+					checked[cpath+"/"+unit] = true
+					l.errorf(cpath, "port reference '%s' is not a port of unit '%s', which uses plan '%s'", ref, unit, plan)
+				}
+			}
+		}
+	}
+
+	for i, v := range l.list("", root, "namespaces") {
+		path := itemPath("namespaces", i)
+		ns, ok := l.mapping(path, v)
+		if !ok {
+			continue
+		}
+		if name, ok := l.name(path, ns, "name"); ok {
+			if namespaces[name] {
+				l.errorf(childPath(path, "name"), "namespace '%s' is declared more than once", name)
+			}
+			namespaces[name] = true
+		}
+
+		for j, u := range l.list(path, ns, "units") {
+			upath := itemPath(childPath(path, "units"), j)
+			ref, ok := l.mapping(upath, u)
+			if !ok {
+				continue
+			}
+			unit, ok := l.name(upath, ref, "ref")
+			if !ok {
+				continue
+			}
+			if _, ok := units[unit]; !ok {
+				l.errorf(childPath(upath, "ref"), "unit '%s' is not declared in units", unit)
+				unit = ""
+			} else {
+				usedUnits[unit] = true
+			}
+			refPlans(upath, ref, unit)
+		}
+
+		for j, b := range l.list(path, ns, "loadbalancers") {
+			bpath := itemPath(childPath(path, "loadbalancers"), j)
+			ref, ok := l.mapping(bpath, b)
+			if !ok {
+				continue
+			}
+			if lb, ok := l.name(bpath, ref, "ref"); ok && !lbs[lb] {
+				l.errorf(childPath(bpath, "ref"), "load balancer '%s' is not declared in loadbalancers", lb)
+			}
+			refPlans(bpath, ref, "")
+		}
+	}
+
+	declaredUnits, _ := root["units"].([]interface{})
+	for i, v := range declaredUnits {
+		if u, ok := v.(map[interface{}]interface{}); ok {
+			if name, ok := u["name"].(string); ok && units[name] != nil && !usedUnits[name] {
+				l.warnf(itemPath("units", i), "unit '%s' is not deployed to any namespace", name)
+			}
+		}
+	}
+	declaredPlans, _ := root["plans"].([]interface{})
+	for i, v := range declaredPlans {
+		if p, ok := v.(map[interface{}]interface{}); ok {
+			if name, ok := p["name"].(string); ok && plans[name] != nil && !usedPlans[name] {
+				l.warnf(itemPath("plans", i), "plan '%s' is not used by any namespace", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const validManifest = `---
+units:
+  - name: howdy-http
+    description: >
+      example http service: says howdy
+    ports:
+      - default->9000/http
+    dependencies:
+      - ref: inventory@1.4
+
+plans:
+  - name: dev-plan
+    cpu: 0.25
+    memory: 2048
+    instances:
+      desired: 1
+    health_checks:
+      - name: http-status
+        port_reference: default
+        protocol: http
+        path: "/v1/status"
+
+namespaces:
+  - name: dev
+    units:
+      - ref: howdy-http
+        plans:
+          - dev-plan
+    loadbalancers:
+      - ref: howdy-lb
+
+loadbalancers:
+  - name: howdy-lb
+    routes:
+      - name: howdy
+        expose: default->8444/http
+        destination: howdy-http->default
+`
+
+func TestLintManifestOfflineValid(t *testing.T) {
+	diags := LintManifestOffline(".nelson.yml", []byte(validManifest))
+	if len(diags) != 0 {
+		t.Errorf("expected no diagnostics, got %v", diags)
+	}
+}
+
+func TestLintManifestOfflineErrors(t *testing.T) {
+	broken := strings.NewReplacer(
+		"port_reference: default", "port_reference: http",
+		"- ref: howdy-lb", "- ref: howdy-lb\n        plans:\n          - prod-plan",
+		"destination: howdy-http->default", "destination: howdy->default",
+	).Replace(validManifest)
+
+	diags := LintManifestOffline(".nelson.yml", []byte(broken))
+	got := []string{}
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	want := []string{
+		".nelson.yml:19:9: error: port reference 'http' is not a port of unit 'howdy-http', which uses plan 'dev-plan'",
+		".nelson.yml:32:11: error: plan 'prod-plan' is not declared in plans",
+		".nelson.yml:39:9: error: destination unit 'howdy' is not declared in units",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestLintManifestOfflineSyntaxError(t *testing.T) {
+	diags := LintManifestOffline("m.yml", []byte("units:\n  - name: a\n   bad: [\n"))
+	if len(diags) != 1 || diags[0].Severity != SeverityError || diags[0].Line < 2 {
+		t.Errorf("expected a single positioned syntax error, got %v", diags)
+	}
+}
+
+func TestLocateYamlPaths(t *testing.T) {
+	positions := locateYamlPaths([]byte(validManifest))
+	cases := map[string]manifestPosition{
+		"units":             {Line: 2, Column: 1},
+		"units[0]":          {Line: 3, Column: 3},
+		"units[0].name":     {Line: 3, Column: 5},
+		"units[0].ports[0]": {Line: 7, Column: 7},
+		"plans[0].health_checks[0].port_reference": {Line: 19, Column: 9},
+		"namespaces[0].units[0].plans[0]":          {Line: 28, Column: 11},
+		"loadbalancers[0].routes[0].destination":   {Line: 37, Column: 9},
+	}
+	for path, want := range cases {
+		if got := positions[path]; got != want {
+			t.Errorf("expected %s at %v, got %v", path, want, got)
+		}
+	}
+}
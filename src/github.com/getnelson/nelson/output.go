@@ -0,0 +1,147 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+var globalOutputFormat string
+
+/*
+ * { "message": "Redeployment requested." }
+ */
+type OutputMessage struct {
+	Message string `json:"message"`
+}
+
+/*
+ * {
+ *   "message": "Nelson manifest validation failed",
+ *   "details": "unit howdy-http does not declare a port named default"
+ * }
+ */
+type OutputFailure struct {
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+func isValidOutputFormat(format string) bool {
+	switch format {
+	case "", OutputTable, OutputJSON, OutputYAML:
+		return true
+	}
+	return false
+}
+
+func isStructuredOutput() bool {
+	return globalOutputFormat == OutputJSON || globalOutputFormat == OutputYAML
+}
+
+///////////////////////////// RENDERING ////////////////////////////////
+
+// Render is the single place command results are written to stdout.
+// In the default table mode the supplied printer is used as-is; in json
+// or yaml mode the value itself is marshalled, and both formats share the
+// field names declared by the json tags of the underlying type.
+func Render(v interface{}, table func()) {
+	if !isStructuredOutput() {
+		table()
+		return
+	}
+	if err := renderStructured(os.Stdout, globalOutputFormat, v); err != nil {
+		PrintTerminalErrors([]error{err})
+		os.Exit(1)
+	}
+}
+
+// RenderMessage is Render for commands whose only result is a one-line
+// status message; the prefix is only used in table mode.
+func RenderMessage(prefix string, msg string) {
+	Render(OutputMessage{Message: msg}, func() { fmt.Println(prefix + msg) })
+}
+
+// RenderFailure reports a command that failed with an explanation, such
+// as a lint. The error goes to stderr as usual; the details go to stdout,
+// as is or as the details of an OutputFailure.
+func RenderFailure(err error, details string) {
+	PrintTerminalError(err)
+	Render(OutputFailure{Message: err.Error(), Details: details}, func() { fmt.Println(details) })
+}
+
+func renderStructured(w io.Writer, format string, v interface{}) error {
+	js, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format == OutputJSON {
+		_, err = fmt.Fprintln(w, string(js))
+		return err
+	}
+	y, err := jsonToYaml(js)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, "---\n"+string(y))
+	return err
+}
+
+// round-trips through json so that yaml output uses the same field
+// names as json output, rather than yaml.v2's lower-cased go names.
+func jsonToYaml(js []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(js))
+	d.UseNumber()
+	var generic interface{}
+	if err := d.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(normalizeJsonNumbers(generic))
+}
+
+// json.Number would otherwise be quoted as a string by the yaml encoder,
+// and float64 would render epoch millis in exponent form.
+func normalizeJsonNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, x := range t {
+			t[k] = normalizeJsonNumbers(x)
+		}
+	case []interface{}:
+		for i, x := range t {
+			t[i] = normalizeJsonNumbers(x)
+		}
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	}
+	return v
+}
@@ -0,0 +1,60 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/getnelson/nelson/client"
+)
+
+func TestRenderStructuredJson(t *testing.T) {
+	stacks := []client.Stack{{Guid: "1a69395e919d", StackName: "foo--1-2-3--abcd", DeployedAt: 1468518896093, Status: "ready"}}
+	var out bytes.Buffer
+	if err := renderStructured(&out, OutputJSON, stacks); err != nil {
+		t.Fatal(err)
+	}
+	fixture := `[
+  {
+    "workflow": "",
+    "guid": "1a69395e919d",
+    "stack_name": "foo--1-2-3--abcd",
+    "deployed_at": 1468518896093,
+    "unit": "",
+    "plan": "",
+    "status": "ready"
+  }
+]
+`
+	if out.String() != fixture {
+		t.Error("Expected \n"+fixture+"\nbut got:\n", out.String())
+	}
+}
+
+func TestRenderStructuredYamlUsesJsonFieldNames(t *testing.T) {
+	s := client.StackSummary{Guid: "e4184c271bb9", UnitName: "foo", DeployedAt: 1468535384221}
+	var out bytes.Buffer
+	if err := renderStructured(&out, OutputYAML, s); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"guid: e4184c271bb9\n", "unit: foo\n", "deployed_at: 1468535384221\n", "dependencies:\n"} {
+		if !bytes.Contains(out.Bytes(), []byte(expected)) {
+			t.Error("Expected yaml output to contain "+expected+"but got:\n", out.String())
+		}
+	}
+}
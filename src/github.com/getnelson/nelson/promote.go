@@ -0,0 +1,238 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+)
+
+// the gates a promotion passes through in each namespace, in order.
+const (
+	GateCommit = "commit" // nelson accepted the commit
+	GateDeploy = "deploy" // a stack of the version appeared in the namespace
+	GateReady  = "ready"  // every such stack became ready
+	GateHealth = "health" // every consul health check of those stacks is passing
+)
+
+/*
+ * {
+ *   "unit": "howdy-http",
+ *   "version": "1.2.3",
+ *   "promoted": false,
+ *   "namespaces": [
+ *     { "namespace": "qa", "passed": true, "stacks": [ "b8ff485a0306" ] },
+ *     { "namespace": "prod", "passed": false, "gate": "health", "stacks": [ "02481438b432" ],
+ *       "message": "2 of 3 health checks are not passing",
+ *       "failing_checks": [ { "check_id": "...", "node": "...", "status": "critical", "name": "..." } ] }
+ *   ]
+ * }
+ */
+type PromotionReport struct {
+	Unit       string          `json:"unit"`
+	Version    string          `json:"version"`
+	Promoted   bool            `json:"promoted"`
+	Namespaces []PromotionStep `json:"namespaces"`
+}
+
+type PromotionStep struct {
+	Namespace string   `json:"namespace"`
+	Passed    bool     `json:"passed"`
+	Stacks    []string `json:"stacks"`
+	// the gate that failed, and why
+	Gate          string                      `json:"gate,omitempty"`
+	Message       string                      `json:"message,omitempty"`
+	FailingChecks []client.StackRuntimeHealth `json:"failing_checks,omitempty"`
+}
+
+// PromoteUnit commits unit@version to each namespace in turn, only moving
+// on once every new stack of that version in the namespace is ready and
+// has consul health checks, all of them passing. It stops at the first gate that fails,
+// or that has not passed within timeout of the commit, and returns the
+// report so far along with the reason. progress is told of each step.
+func PromoteUnit(ctx context.Context, c *client.Client, unit string, version string, namespaces []string, timeout time.Duration, interval time.Duration, progress func(string)) (PromotionReport, error) {
+	report := PromotionReport{Unit: unit, Version: version, Namespaces: []PromotionStep{}}
+	for _, ns := range namespaces {
+		step, err := promoteTo(ctx, c, unit, version, ns, timeout, interval, progress)
+		report.Namespaces = append(report.Namespaces, step)
+		if err != nil {
+			return report, err
+		}
+	}
+	report.Promoted = true
+	return report, nil
+}
+
+func promoteTo(ctx context.Context, c *client.Client, unit string, version string, ns string, timeout time.Duration, interval time.Duration, progress func(string)) (PromotionStep, error) {
+	step := PromotionStep{Namespace: ns, Stacks: []string{}}
+	fail := func(gate string, err error) (PromotionStep, error) {
+		step.Gate = gate
+		step.Message = err.Error()
+		return step, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// stacks of the version left over from an earlier commit, which may be
+	// in any state, must not decide the gates for this one
+	previous, err := stacksOfVersion(ctx, c, unit, version, ns)
+	if err != nil {
+		return fail(GateCommit, err)
+	}
+	if err := c.CommitUnit(ctx, client.CommitRequest{UnitName: unit, Version: version, Target: ns}); err != nil {
+		return fail(GateCommit, err)
+	}
+	progress("Committed " + unit + "@" + version + " to '" + ns + "'.")
+
+	stacks, err := awaitStacks(ctx, c, unit, version, ns, previous, interval)
+	if err != nil {
+		return fail(GateDeploy, gateError(ctx, err, "no new stack of "+unit+"@"+version+" appeared in '"+ns+"'"))
+	}
+	step.Stacks = stacks
+
+	for _, guid := range stacks {
+		progress("Waiting for stack " + guid + " in '" + ns + "' to become ready.")
+		status, err := WaitForStack(ctx, c, guid, "ready", interval, 30*time.Second, func(client.StackStatus) {})
+		if err != nil {
+			return fail(GateReady, gateError(ctx, err, "stack "+guid+" did not become ready"))
+		}
+		if status != "ready" {
+			return fail(GateReady, errors.New("stack "+guid+" is "+status+", not ready"))
+		}
+	}
+
+	for _, guid := range stacks {
+		progress("Waiting for the health checks of stack " + guid + " in '" + ns + "' to pass.")
+		failing, err := awaitHealth(ctx, c, guid, interval)
+		if err != nil {
+			step.FailingChecks = failing
+			return fail(GateHealth, gateError(ctx, err, fmt.Sprintf("%d health checks of stack %s are not passing", len(failing), guid)))
+		}
+	}
+
+	step.Passed = true
+	progress("'" + ns + "' passed every gate.")
+	return step, nil
+}
+
+// a gate that timed out is reported by what it was waiting for.
+func gateError(ctx context.Context, err error, waitingFor string) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.New("timed out: " + waitingFor)
+	}
+	return err
+}
+
+// the guids of the stacks of the version in the namespace.
+func stacksOfVersion(ctx context.Context, c *client.Client, unit string, version string, ns string) (map[string]bool, error) {
+	stacks, err := c.ListStacks(ctx, "", ns, "", unit)
+	if err != nil {
+		return nil, err
+	}
+	guids := map[string]bool{}
+	for _, s := range stacks {
+		if s.UnitName == unit && versionMatches(s.StackName, version) {
+			guids[s.Guid] = true
+		}
+	}
+	return guids, nil
+}
+
+// polls until at least one stack of the version that is not in previous
+// is deployed to the namespace, returning the guids of all such stacks.
+func awaitStacks(ctx context.Context, c *client.Client, unit string, version string, ns string, previous map[string]bool, interval time.Duration) ([]string, error) {
+	for {
+		current, err := stacksOfVersion(ctx, c, unit, version, ns)
+		if err != nil {
+			return nil, err
+		}
+		guids := []string{}
+		for guid := range current {
+			if !previous[guid] {
+				guids = append(guids, guid)
+			}
+		}
+		if len(guids) > 0 {
+			sort.Strings(guids)
+			return guids, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// polls until the stack has at least one consul health check and every
+// one of them is passing; a stack that registered no checks has shown
+// nothing about its health. On failure the checks that were not passing
+// at the last poll are returned.
+func awaitHealth(ctx context.Context, c *client.Client, guid string, interval time.Duration) ([]client.StackRuntimeHealth, error) {
+	var failing []client.StackRuntimeHealth
+	for {
+		rt, err := c.GetStackRuntime(ctx, guid)
+		if err != nil {
+			return failing, err
+		}
+		failing = []client.StackRuntimeHealth{}
+		for _, h := range rt.ConsulHealth {
+			if h.Status != "passing" {
+				failing = append(failing, h)
+			}
+		}
+		if len(rt.ConsulHealth) > 0 && len(failing) == 0 {
+			return nil, nil
+		}
+		select {
+		case <-ctx.Done():
+			return failing, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func PrintPromotionReport(r PromotionReport) {
+	var tabulized = [][]string{}
+	for _, s := range r.Namespaces {
+		result := "passed"
+		if !s.Passed {
+			result = "failed at " + s.Gate + ": " + s.Message
+		}
+		tabulized = append(tabulized, []string{s.Namespace, strings.Join(s.Stacks, ", "), result})
+	}
+	fmt.Println("===>> Promotion of " + r.Unit + "@" + r.Version)
+	RenderTableToStdout([]string{"Namespace", "Stacks", "Result"}, tabulized)
+
+	for _, s := range r.Namespaces {
+		if len(s.FailingChecks) > 0 {
+			fmt.Println("")
+			fmt.Println("===>> Failing health checks in '" + s.Namespace + "'")
+			var checks = [][]string{}
+			for _, h := range s.FailingChecks {
+				checks = append(checks, []string{h.CheckId, h.Node, h.Status, h.Name})
+			}
+			RenderTableToStdout([]string{"ID", "Node", "Status", "Name"}, checks)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+)
+
+// a nelson that deploys a stack per commit, which is ready straight away
+// and whose health is given per namespace; a namespace with no health
+// registers no checks at all. qa also holds a failed stack of the same
+// version, left over from an earlier commit.
+func promotionServer(t *testing.T, health map[string]string, commits *[]string) *httptest.Server {
+	guids := map[string]string{"qa": "aaaaaaaaaaaa", "prod": "bbbbbbbbbbbb"}
+	deployed := map[string]bool{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/v1/units/commit":
+			var req client.CommitRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			*commits = append(*commits, req.Target)
+			deployed[req.Target] = true
+		case r.URL.Path == "/v1/deployments":
+			ns := r.URL.Query().Get("ns")
+			stacks := []string{`{"guid": "cccccccccccc", "stack_name": "howdy--1-2-2--old", "unit": "howdy"}`}
+			if ns == "qa" {
+				stacks = append(stacks, `{"guid": "dddddddddddd", "stack_name": "howdy--1-2-3--stale", "unit": "howdy", "status": "failed"}`)
+			}
+			if deployed[ns] {
+				stacks = append(stacks, `{"guid": "`+guids[ns]+`", "stack_name": "howdy--1-2-3--`+ns+`", "unit": "howdy"}`)
+			}
+			w.Write([]byte("[" + strings.Join(stacks, ",") + "]"))
+		case strings.HasSuffix(r.URL.Path, "dddddddddddd/runtime"):
+			w.Write([]byte(`{"current_status": "failed", "consul_health": [
+				{"check_id": "http", "node": "n1", "status": "critical", "name": "http"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/runtime"):
+			ns := "qa"
+			if strings.Contains(r.URL.Path, guids["prod"]) {
+				ns = "prod"
+			}
+			if health[ns] == "" {
+				w.Write([]byte(`{"current_status": "ready", "consul_health": []}`))
+				return
+			}
+			w.Write([]byte(`{"current_status": "ready", "consul_health": [
+				{"check_id": "http", "node": "n1", "status": "passing", "name": "http"},
+				{"check_id": "grpc", "node": "n1", "status": "` + health[ns] + `", "name": "grpc"}]}`))
+		default:
+			w.Write([]byte(`{"statuses": []}`))
+		}
+	}))
+}
+
+func TestPromoteUnit(t *testing.T) {
+	var commits []string
+	server := promotionServer(t, map[string]string{"qa": "passing", "prod": "passing"}, &commits)
+	defer server.Close()
+
+	report, err := PromoteUnit(context.Background(), client.New(server.URL, client.Session{}), "howdy", "1.2.3", []string{"qa", "prod"}, time.Second, time.Millisecond, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Promoted || len(report.Namespaces) != 2 || strings.Join(commits, ",") != "qa,prod" {
+		t.Errorf("unexpected report %+v after commits %v", report, commits)
+	}
+	if s := report.Namespaces[1]; !s.Passed || len(s.Stacks) != 1 || s.Stacks[0] != "bbbbbbbbbbbb" {
+		t.Errorf("unexpected step %+v", s)
+	}
+}
+
+func TestPromoteUnitStopsAtFailedGate(t *testing.T) {
+	var commits []string
+	server := promotionServer(t, map[string]string{"qa": "critical", "prod": "passing"}, &commits)
+	defer server.Close()
+
+	report, err := PromoteUnit(context.Background(), client.New(server.URL, client.Session{}), "howdy", "1.2.3", []string{"qa", "prod"}, 50*time.Millisecond, time.Millisecond, func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected the health gate to time out, got %v", err)
+	}
+	if report.Promoted || len(report.Namespaces) != 1 || strings.Join(commits, ",") != "qa" {
+		t.Errorf("expected to stop in qa, got %+v after commits %v", report, commits)
+	}
+	s := report.Namespaces[0]
+	if s.Passed || s.Gate != GateHealth || len(s.FailingChecks) != 1 || s.FailingChecks[0].CheckId != "grpc" {
+		t.Errorf("unexpected step %+v", s)
+	}
+}
+
+func TestPromoteUnitIgnoresStaleStacks(t *testing.T) {
+	var commits []string
+	server := promotionServer(t, map[string]string{"qa": "passing", "prod": "passing"}, &commits)
+	defer server.Close()
+
+	report, err := PromoteUnit(context.Background(), client.New(server.URL, client.Session{}), "howdy", "1.2.3", []string{"qa"}, time.Second, time.Millisecond, func(string) {})
+	if err != nil {
+		t.Fatalf("expected the failed stack from an earlier commit not to fail the gates, got %v", err)
+	}
+	if s := report.Namespaces[0]; !s.Passed || len(s.Stacks) != 1 || s.Stacks[0] != "aaaaaaaaaaaa" {
+		t.Errorf("expected to gate only on the stack this commit deployed, got %+v", s)
+	}
+}
+
+func TestPromoteUnitRequiresHealthChecks(t *testing.T) {
+	var commits []string
+	server := promotionServer(t, map[string]string{}, &commits)
+	defer server.Close()
+
+	report, err := PromoteUnit(context.Background(), client.New(server.URL, client.Session{}), "howdy", "1.2.3", []string{"qa"}, 50*time.Millisecond, time.Millisecond, func(string) {})
+	if err == nil || report.Promoted || report.Namespaces[0].Gate != GateHealth {
+		t.Errorf("expected a stack without health checks to fail the health gate, got %+v: %v", report, err)
+	}
+}
@@ -17,132 +17,25 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"github.com/parnurzeal/gorequest"
-)
-
-/**
- * {
- * 	 "repository": "xs4s",
- * 	 "slug": "iptv/xs4s",
- * 	 "id": 8272,
- * 	 "hook": {
- *     "is_active": true,
- *     "id": 3775
- *   },
- * 	 "owner": "iptv",
- * 	 "access": "push"
- * }
- */
-
-type RepoHook struct {
-	IsActive bool `json:"is_active"`
-	Id       int  `json:"id"`
-}
-
-type RepoSummary struct {
-	Repository string    `json:"repository"`
-	Slug       string    `json:"slug"`
-	Id         int       `json:"id"`
-	Hook       *RepoHook `json:"hook"`
-	Owner      string    `json:"owner"`
-	Access     string    `json:"access"`
-}
-
-func SyncRepos(http *gorequest.SuperAgent, cfg *Config) []error {
-	uri := cfg.Endpoint + "/v1/profile/sync"
-	r, _, errs := AugmentRequest(http.Post(uri), cfg).EndBytes()
-
-	if errs != nil {
-		return errs
-	}
-
-	if r.StatusCode/100 != 2 {
-		errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		return errs
-	}
-	return nil
-}
-
-func ListRepos(owner string, http *gorequest.SuperAgent, cfg *Config) (list []RepoSummary, err []error) {
-	uri := cfg.Endpoint + "/v1/repos?owner=" + owner
-	r, body, errs := AugmentRequest(http.Get(uri), cfg).EndBytes()
-
-	if errs != nil {
-		return nil, errs
-	}
-
-	if r.StatusCode/100 != 2 {
-		errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		return nil, errs
-	} else {
-		var list []RepoSummary
-		if err := json.Unmarshal(body, &list); err != nil {
-			panic(err)
-		}
-		return list, errs
-	}
-}
-
-type EnableRepoRequest struct {
-	Owner string `json:"owner"`
-	Repo  string `json:"repo"`
-}
-
-func Enable(req EnableRepoRequest, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-	uri := cfg.Endpoint + "/v1/repos/" + req.Owner + "/" + req.Repo + "/hook"
-	r, body, errs := AugmentRequest(http.Post(uri), cfg).Send(req).EndBytes()
-
-	if errs != nil {
-		return "", errs
-	}
 
-	if r.StatusCode/100 != 2 {
-		resp := string(body[:])
-		errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		return resp, errs
-	} else {
-		return "The project " + req.Owner + "/" + req.Repo + " has been enabled.", errs
-	}
-}
-
-func Disable(req EnableRepoRequest, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-
-	uri := cfg.Endpoint + "/v1/repos/" + req.Owner + "/" + req.Repo + "/hook"
-	r, body, errs := AugmentRequest(http.Delete(uri), cfg).Send(req).EndBytes()
-
-	if errs != nil {
-		return "", errs
-	}
+	"github.com/getnelson/nelson/client"
+)
 
-	if r.StatusCode/100 != 2 {
-		resp := string(body[:])
-		errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		return resp, errs
-	} else {
-		return "The project " + req.Owner + "/" + req.Repo + " has been disabled.", errs
-	}
+var repoColumns = []Column{
+	{Name: "repository", Header: "Repository", Value: func(r interface{}) string { return r.(client.RepoSummary).Repository }},
+	{Name: "owner", Header: "Owner", Value: func(r interface{}) string { return r.(client.RepoSummary).Owner }},
+	{Name: "access", Header: "Access", Value: func(r interface{}) string { return r.(client.RepoSummary).Access }},
+	{Name: "status", Header: "Status", Value: func(r interface{}) string {
+		x := r.(client.RepoSummary)
+		return formatEnabled(x.Hook != nil && x.Hook.IsActive)
+	}},
+	{Name: "slug", Header: "Slug", Value: func(r interface{}) string { return r.(client.RepoSummary).Slug }, Optional: true},
 }
 
-func PrintListRepos(repos []RepoSummary) {
-	var tabulized = [][]string{}
-	for _, x := range repos {
-		var enabled bool = x.Hook != nil && x.Hook.IsActive
-		tabulized = append(tabulized, []string{
-			x.Repository,
-			x.Owner,
-			x.Access,
-			formatEnabled(enabled),
-		})
-	}
-
-	RenderTableToStdout([]string{
-		"Repository",
-		"Owner",
-		"Access",
-		"Status",
-	}, tabulized)
+func PrintListRepos(repos []client.RepoSummary) {
+	RenderList(repos, repoColumns)
 }
 
 func formatEnabled(enabled bool) string {
@@ -152,3 +45,21 @@ func formatEnabled(enabled bool) string {
 		return "disabled"
 	}
 }
+
+// DescribeRepo looks up a repository for a confirmation prompt.
+func DescribeRepo(ctx context.Context, c *client.Client, owner string, repo string) ([][]string, error) {
+	repos, err := c.ListRepos(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range repos {
+		if r.Repository == repo {
+			return [][]string{
+				{"Repository", r.Slug},
+				{"Access", r.Access},
+				{"Status", formatEnabled(r.Hook != nil && r.Hook.IsActive)},
+			}, nil
+		}
+	}
+	return nil, errors.New("no repository " + owner + "/" + repo + " is known to Nelson")
+}
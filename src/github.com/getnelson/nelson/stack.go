@@ -17,188 +17,22 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"net/url"
+	"os"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
-	"github.com/parnurzeal/gorequest"
+	"github.com/getnelson/nelson/client"
+	"gopkg.in/urfave/cli.v1"
 )
 
-/////////////////// MANUAL DEPLOYMENT ///////////////////
-
-/*
- * {
- *   "datacenter": "perryman",
- *   "namespace": "stage",
- *   "serviceType": "cassandra",
- *   "version": "1.2.3,
- *   "hash": "abcd1234",
- *   "description": "a cassandra for great good",
- *   "port": 1234
- * }
- */
-type ManualDeploymentRequest struct {
-	Datacenter  string `json:"datacenter"`
-	Namespace   string `json:"namespace"`
-	ServiceType string `json:"service_type"`
-	Version     string `json:"version"`
-	Hash        string `json:"hash"`
-	Port        int64  `json:"port"`
-	Description string `json:"description"`
-}
-
-func RegisterManualDeployment(
-	req ManualDeploymentRequest,
-	http *gorequest.SuperAgent, cfg *Config) (string, []error) {
-
-	r, body, errs := AugmentRequest(
-		http.Post(cfg.Endpoint+"/v1/deployments"), cfg).Send(req).EndBytes()
-
-	if errs != nil {
-		return "", errs
-	}
-
-	if r.StatusCode/100 != 2 {
-		resp := string(body[:])
-		errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		return resp, errs
-	} else {
-		return "Manual stack has been registered.", errs
-	}
-}
-
-/////////////////// REVERSE ///////////////////
-type ReverseTrafficShiftErr struct {
-	Message string `json:"message"`
-}
-
-func ReverseTrafficShift(
-	guid string,
-	http *gorequest.SuperAgent, cfg *Config) (string, []error) {
-
-	r, body, errs := AugmentRequest(
-		http.Post(cfg.Endpoint+"/v1/deployments/"+guid+"/trafficshift/reverse"), cfg).EndBytes()
-
-	if errs != nil {
-		return "", errs
-	}
-
-	if r.StatusCode/100 != 2 {
-		resp := string(body[:])
-		errs = append(errs, errors.New("Bad response from Nelson server. Status code: "+strconv.Itoa(r.StatusCode)))
-
-		var er ReverseTrafficShiftErr
-		if err := json.Unmarshal(body, &er); err == nil {
-			errs = append(errs, errors.New(er.Message))
-		}
-
-		return resp, errs
-	} else {
-		return "Traffic shift reversed.", errs
-	}
-
-}
-
-/////////////////// INSPECT ///////////////////
-
-/*
- * {
- *   "timestamp": "2016-06-28T20:02:34.449Z",
- *   "message": "instructing perryman's chronos to handle job container",
- *   "status": "deploying"
- * }
- */
-type StackStatus struct {
-	Timestamp string `json:"timestamp"`
-	Message   string `json:"message"`
-	Status    string `json:"status"`
-}
-
-/*
- *   "dependencies": {
- *     "outbound": [
- *      ...
- *     ],
- *     "inbound": []
- *   },
- */
-type StackDependencies struct {
-	Outbound []Stack `json:"outbound"`
-	Inbound  []Stack `json:"inbound"`
-}
-
-/*
- * {
- *   "workflow": "pulsar",
- *   "guid": "e4184c271bb9",
- *   "statuses": [
- *     {
- *       "timestamp": "2016-07-14T22:30:22.358Z",
- *       "message": "inventory-inventory deployed to perryman",
- *       "status": "ready"
- *     },
- *     ...
- *   ],
- *   "stack_name": "inventory-inventory--2-0-11--8gufie2b",
- *   "deployed_at": 1468535384221,
- *   "unit": "inventory-inventory",
- *   "plan": "service",
- *   "expiration": 1469928212871,
- *   "dependencies": {
- *     "outbound": [
- *       {
- *         "workflow": "manual",
- *         "guid": "1a69395e919d",
- *         "stack_name": "dev-iptv-cass-dev--4-8-4--mtq2odqzndc0mg",
- *         "deployed_at": 1468518896093,
- *         "unit": "dev-iptv-cass-dev",
- *         "plan": "service"
- *       }
- *     ],
- *     "inbound": []
- *   },
- *   "namespace": "dev"
- * }
- */
-type StackSummary struct {
-	Workflow     string            `json:"workflow"`
-	Guid         string            `json:"guid"`
-	StackName    string            `json:"stack_name"`
-	DeployedAt   int64             `json:"deployed_at"`
-	UnitName     string            `json:"unit"`
-	Plan         string            `json:"plan"`
-	NamespaceRef string            `json:"namespace"`
-	Expiration   int64             `json:"expiration"`
-	Statuses     []StackStatus     `json:"statuses"`
-	Dependencies StackDependencies `json:"dependencies"`
-	Resources    []string          `json:"resources"`
-}
-
-func InspectStack(guid string, http *gorequest.SuperAgent, cfg *Config) (result StackSummary, err []error) {
-	r, bytes, errs := AugmentRequest(
-		http.Get(cfg.Endpoint+"/v1/deployments/"+guid), cfg).EndBytes()
-
-	if errs != nil {
-		return StackSummary{}, errs
-	}
-
-	if r.StatusCode/100 != 2 {
-		errs = append(errs, errors.New("Bad response from Nelson server"))
-		// zomg, constructor just nulls *all* the fields, because who cares about correctness!
-		return StackSummary{}, errs
-	} else {
-		var result StackSummary
-		if err := json.Unmarshal(bytes, &result); err != nil {
-			panic(err)
-		}
-		return result, errs
-	}
-}
-
-func PrintInspectStack(s StackSummary) {
+func PrintInspectStack(s client.StackSummary) {
 	//>>>>>>>>>>> status history
 	var tabulized = [][]string{}
 	tabulized = append(tabulized, []string{"GUID:", s.Guid})
@@ -257,191 +91,110 @@ func PrintInspectStack(s StackSummary) {
 	RenderTableToStdout([]string{"Status", "Timestamp", "Message"}, statuslines)
 }
 
-/////////////////// REDEPLOYMENT ///////////////////
-
-func Redeploy(guid string, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-	r, body, errs := AugmentRequest(
-		http.Post(cfg.Endpoint+"/v1/deployments/"+guid+"/redeploy"), cfg).EndBytes()
-
-	if errs != nil {
-		return "", errs
-	}
-
-	if r.StatusCode/100 != 2 {
-		resp := string(body[:])
-		errs = append(errs, errors.New("bad response from Nelson server"))
-		return resp, errs
-	} else {
-		return "Redeployment requested.", errs
-	}
+var stackColumns = []Column{
+	{Name: "guid", Header: "GUID", Value: func(r interface{}) string { return r.(client.Stack).Guid }},
+	{Name: "namespace", Header: "Namespace", Value: func(r interface{}) string { return r.(client.Stack).NamespaceRef }},
+	{Name: "stack_name", Header: "Stack", Value: func(r interface{}) string { return truncateString(r.(client.Stack).StackName, 55) }},
+	{Name: "status", Header: "Status", Value: func(r interface{}) string { return r.(client.Stack).Status }},
+	{Name: "plan", Header: "Plan", Value: func(r interface{}) string { return r.(client.Stack).Plan }},
+	{Name: "workflow", Header: "Workflow", Value: func(r interface{}) string { return r.(client.Stack).Workflow }},
+	{Name: "deployed_at", Header: "Deployed At", Value: func(r interface{}) string { return javaEpochToHumanizedTime(r.(client.Stack).DeployedAt) }},
+	{Name: "unit", Header: "Unit", Value: func(r interface{}) string { return r.(client.Stack).UnitName }, Optional: true},
+	{Name: "type", Header: "Type", Value: func(r interface{}) string { return r.(client.Stack).Type }, Optional: true},
 }
 
-/////////////////// LISTING STACKS ///////////////////
-
-/**
- * {
- *   "workflow": "quasar",
- *   "guid": "67e04d28d6ab",
- *   "stack_name": "blobstore-testsuite--0-1-55--kbqg9nff",
- *   "deployed_at": 1467225866870,
- *   "unit": "blobstore-testsuite",
- *   "plan": "fooo",
- *   "namespace": "dev"
- * }
- */
-type Stack struct {
-	Workflow     string `json:"workflow"`
-	Guid         string `json:"guid"`
-	StackName    string `json:"stack_name"`
-	DeployedAt   int64  `json:"deployed_at"`
-	UnitName     string `json:"unit"`
-	Plan         string `json:"plan"`
-	Type         string `json:"type,omitempty"`
-	NamespaceRef string `json:"namespace,omitempty"`
-	Status       string `json:"status"`
-	Weight       int64  `json:"weight,omitempty"`
+func PrintListStacks(stacks []client.Stack) {
+	RenderList(stacks, stackColumns)
 }
 
-func ListStacks(delimitedDcs string, delimitedNamespaces string, delimitedStatuses string, unit string, http *gorequest.SuperAgent, cfg *Config) (list []Stack, err []error) {
-	uri := "/v1/deployments?"
-	qs := url.Values{}
-	// set the datacenters if specified
-	if isValidCommaDelimitedList(delimitedDcs) {
-		qs.Set("dc", delimitedDcs)
-	}
-	if isValidCommaDelimitedList(delimitedStatuses) {
-		qs.Set("status", delimitedStatuses)
-	} else {
-		// if the user didnt specify statuses, they probally want all the stacks except historical terminated ones.
-		qs.Set("status", "pending,deploying,warming,ready,deprecated,failed")
-	}
-	if isValidCommaDelimitedList(delimitedNamespaces) {
-		qs.Set("ns", delimitedNamespaces)
-	} else {
-		qs.Set("ns", "dev,qa,prod")
-	}
-	if unit != "" {
-		qs.Set("unit", unit)
-	}
-	uri = uri + qs.Encode()
-
-	r, bytes, errs := AugmentRequest(
-		http.Get(cfg.Endpoint+uri), cfg).EndBytes()
-
-	if errs != nil {
-		return nil, errs
-	}
+func PrintDeploymentLog(guid string, logs client.StackLog) {
+	fmt.Println("===>> logs for stack " + guid)
 
-	if r.StatusCode/100 != 2 {
-		errs = append(errs, errors.New("Bad response from Nelson server"))
-		return nil, errs
-	} else {
-		var list []Stack
-		if err := json.Unmarshal(bytes, &list); err != nil {
-			panic(err)
-		}
-		return list, errs
+	for _, l := range logs.Content {
+		fmt.Println(l)
 	}
 }
 
-func PrintListStacks(stacks []Stack) {
-	var tabulized = [][]string{}
-	for _, s := range stacks {
-		tabulized = append(tabulized, []string{s.Guid, s.NamespaceRef, truncateString(s.StackName, 55), s.Status, s.Plan, s.Workflow, javaEpochToHumanizedTime(s.DeployedAt)})
-	}
-
-	RenderTableToStdout([]string{"GUID", "Namespace", "Stack", "Status", "Plan", "Workflow", "Deployed At"}, tabulized)
+// statuses after which a stack makes no further deployment progress
+var terminalStackStatuses = map[string]bool{
+	"ready":      true,
+	"deprecated": true,
+	"garbage":    true,
+	"failed":     true,
+	"terminated": true,
+	"manual":     true,
 }
 
-/////////////////// DEPLOYMENT LOG ///////////////////
-
-type StackLog struct {
-	Content []string `json:"content"`
-	Offset  int      `json:"offset"`
+func isTerminalStatus(status string) bool {
+	return terminalStackStatuses[status]
 }
 
-// v1/deployments/:id/log
-func GetDeploymentLog(guid string, http *gorequest.SuperAgent, cfg *Config) {
-	_, bytes, errs := AugmentRequest(
-		http.Get(cfg.Endpoint+"/v1/deployments/"+guid+"/log"), cfg).EndBytes()
-
-	if len(errs) > 0 {
-		panic(errs)
-	}
-
-	var logs StackLog
-	if err := json.Unmarshal(bytes, &logs); err != nil {
-		panic(err)
+// drops any lines before offset, so that following a log works
+// whether or not the server honoured the offset it was asked for.
+func unseenLogLines(offset int, logs client.StackLog) client.StackLog {
+	skip := offset - logs.Offset
+	if skip <= 0 {
+		return logs
 	}
-
-	fmt.Println("===>> logs for stack " + guid)
-
-	for _, l := range logs.Content {
-		fmt.Println(l)
+	if skip >= len(logs.Content) {
+		return client.StackLog{Content: []string{}, Offset: offset}
 	}
+	return client.StackLog{Content: logs.Content[skip:], Offset: offset}
 }
 
-/////////////////// RUNTIME INSPECT ///////////////////
-
-/*
- * {
- *   "consul_health": [{
- *     "check_id": "64c0a2b5bd2972c9521fb7313b00db7dad58c04c",
- *     "node": "ip-10-113-128-190",
- *     "status": "passing",
- *     "name": "service: default howdy-http--1-0-344--9uuu1mp2 check"
- *   }],
- *   "scheduler": {
- *     "failed": 0,
- *     "completed": 0,
- *     "pending": 0,
- *     "running": 1
- *   },
- *   "current_status": "ready",
- *   "expires_at" : 10101333
- * }
- */
-type StackRuntime struct {
-	CurrentStatus string                `json:"current_status"`
-	ExpiresAt     int64                 `json:"expires_at"`
-	Scheduler     StackRuntimeScheduler `json:"scheduler"`
-	ConsulHealth  []StackRuntimeHealth  `json:"consul_health"`
+// keeps the last n lines; n <= 0 keeps everything.
+func tailLogLines(n int, logs client.StackLog) client.StackLog {
+	if n <= 0 || n >= len(logs.Content) {
+		return logs
+	}
+	skip := len(logs.Content) - n
+	return client.StackLog{Content: logs.Content[skip:], Offset: logs.Offset + skip}
 }
 
-type StackRuntimeHealth struct {
-	CheckId string `json:"check_id"`
-	Node    string `json:"node"`
-	Status  string `json:"status"`
-	Name    string `json:"name"`
+// FetchDeploymentLog reads the log from offset, keeping only the last
+// tail lines when tail is positive.
+func FetchDeploymentLog(ctx context.Context, c *client.Client, guid string, offset int, tail int) (client.StackLog, error) {
+	logs, err := c.GetDeploymentLog(ctx, guid, offset)
+	if err != nil {
+		return client.StackLog{}, err
+	}
+	return tailLogLines(tail, unseenLogLines(offset, logs)), nil
 }
 
-type StackRuntimeScheduler struct {
-	Failed    int `json:"failed"`
-	Completed int `json:"completed"`
-	Pending   int `json:"pending"`
-	Running   int `json:"running"`
-}
+// FollowDeploymentLog polls the log, passing every batch of new lines to
+// emit, until the stack reaches a terminal status. The status is checked
+// before each read so that the final read drains the log. Returns the
+// terminal status.
+func FollowDeploymentLog(ctx context.Context, c *client.Client, guid string, offset int, tail int, interval time.Duration, emit func(client.StackLog)) (string, error) {
+	for {
+		rt, err := c.GetStackRuntime(ctx, guid)
+		if err != nil {
+			return "", err
+		}
 
-func GetStackRuntime(guid string, http *gorequest.SuperAgent, cfg *Config) (runtime StackRuntime, err []error) {
-	r, bytes, errs := AugmentRequest(
-		http.Get(cfg.Endpoint+"/v1/deployments/"+guid+"/runtime"), cfg).EndBytes()
+		logs, err := FetchDeploymentLog(ctx, c, guid, offset, tail)
+		if err != nil {
+			return "", err
+		}
+		tail = 0 // only the first read is tailed
+		if len(logs.Content) > 0 {
+			emit(logs)
+		}
+		offset = logs.Offset + len(logs.Content)
 
-	if errs != nil {
-		return StackRuntime{}, errs
-	}
+		if isTerminalStatus(rt.CurrentStatus) {
+			return rt.CurrentStatus, nil
+		}
 
-	if r.StatusCode/100 != 2 {
-		errs = append(errs, errors.New("bad response from Nelson server"))
-		return runtime, errs
-	} else {
-		if err := json.Unmarshal(bytes, &runtime); err != nil {
-			panic(err)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
 		}
-		return runtime, errs
 	}
 }
 
-func PrintStackRuntime(r StackRuntime) {
+func PrintStackRuntime(r client.StackRuntime) {
 
 	fmt.Println("")
 	fmt.Println("==>> Stack Status")
@@ -473,3 +226,194 @@ func PrintStackRuntime(r StackRuntime) {
 	RenderTableToStdout([]string{"ID", "Node", "Status", "Details"}, tabulized)
 
 }
+
+/////////////////// WAITING ///////////////////
+
+// every status a stack can be in, in rough lifecycle order
+var knownStackStatuses = []string{
+	"pending", "deploying", "warming", "ready", "deprecated", "garbage", "failed", "terminated", "manual",
+}
+
+func isKnownStackStatus(status string) bool {
+	for _, s := range knownStackStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the statuses in history not already in seen, oldest first,
+// and marks them as seen.
+func unseenStatuses(seen map[client.StackStatus]bool, history []client.StackStatus) []client.StackStatus {
+	fresh := []client.StackStatus{}
+	for _, s := range history {
+		if !seen[s] {
+			seen[s] = true
+			fresh = append(fresh, s)
+		}
+	}
+	sort.SliceStable(fresh, func(i, j int) bool {
+		return fresh[i].Timestamp < fresh[j].Timestamp
+	})
+	return fresh
+}
+
+// WaitForStack polls the stack until it reaches target, or some other
+// terminal status, passing each new entry of the status history to emit.
+// The poll interval starts at interval and doubles up to maxInterval.
+// Returns the status the stack settled on; give ctx a deadline to bound
+// the wait.
+func WaitForStack(ctx context.Context, c *client.Client, guid string, target string, interval time.Duration, maxInterval time.Duration, emit func(client.StackStatus)) (string, error) {
+	seen := map[client.StackStatus]bool{}
+	for {
+		s, err := c.InspectStack(ctx, guid)
+		if err != nil {
+			return "", err
+		}
+		for _, st := range unseenStatuses(seen, s.Statuses) {
+			emit(st)
+		}
+
+		rt, err := c.GetStackRuntime(ctx, guid)
+		if err != nil {
+			return "", err
+		}
+		if rt.CurrentStatus == target || isTerminalStatus(rt.CurrentStatus) {
+			return rt.CurrentStatus, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return rt.CurrentStatus, ctx.Err()
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+func PrintStackStatus(s client.StackStatus) {
+	fmt.Println(s.Timestamp + "  " + s.Status + "  " + s.Message)
+}
+
+// DescribeStack looks up a stack for a confirmation prompt.
+func DescribeStack(ctx context.Context, c *client.Client, guid string) ([][]string, error) {
+	s, err := c.InspectStack(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+	status := ""
+	if len(s.Statuses) > 0 {
+		status = s.Statuses[0].Status
+	}
+	return [][]string{
+		{"GUID", s.Guid},
+		{"Stack", s.StackName},
+		{"Namespace", s.NamespaceRef},
+		{"Plan", s.Plan},
+		{"Status", status},
+	}, nil
+}
+
+/////////////////// RESOLUTION ///////////////////
+
+// AmbiguousStackError is returned by ResolveStack when a reference
+// matches more than one stack.
+type AmbiguousStackError struct {
+	Ref        string
+	Candidates []client.Stack
+}
+
+func (e AmbiguousStackError) Error() string {
+	return "'" + e.Ref + "' matches " + strconv.Itoa(len(e.Candidates)) + " stacks; use more of the GUID, or the full stack name"
+}
+
+var guidPrefixPattern = regexp.MustCompile(`^[a-z0-9]{4,12}$`)
+
+// ResolveStack returns the guid of the stack that ref names: a full guid
+// is used as-is, otherwise ref may be a unique prefix of a guid (of at
+// least four characters), a full stack name, or unit@version where the
+// version is either 1.2.3 or just the feature version 1.2. Stacks in
+// every status are searched, in the given namespaces (or dev, qa and prod
+// when empty); when a ref matches several stacks of which only one has
+// not been terminated, that one is chosen.
+func ResolveStack(ctx context.Context, c *client.Client, ref string, namespaces string) (string, error) {
+	if isValidGUID(ref) {
+		return ref, nil
+	}
+	if len(ref) == 0 {
+		return "", errors.New("no stack was specified")
+	}
+
+	unit := ""
+	if i := strings.LastIndex(ref, "@"); i > 0 {
+		unit = ref[:i]
+	}
+	stacks, err := c.ListStacks(ctx, "", namespaces, strings.Join(knownStackStatuses, ","), unit)
+	if err != nil {
+		return "", err
+	}
+
+	matches := []client.Stack{}
+	live := []client.Stack{}
+	for _, s := range stacks {
+		if stackMatches(s, ref) {
+			matches = append(matches, s)
+			if s.Status != "terminated" {
+				live = append(live, s)
+			}
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		return "", errors.New("no stack matches '" + ref + "'")
+	case len(matches) == 1:
+		return matches[0].Guid, nil
+	case len(live) == 1:
+		return live[0].Guid, nil
+	}
+	return "", AmbiguousStackError{Ref: ref, Candidates: matches}
+}
+
+func stackMatches(s client.Stack, ref string) bool {
+	if s.StackName == ref {
+		return true
+	}
+	if i := strings.LastIndex(ref, "@"); i > 0 {
+		return s.UnitName == ref[:i] && versionMatches(s.StackName, ref[i+1:])
+	}
+	return guidPrefixPattern.MatchString(ref) && strings.HasPrefix(s.Guid, ref)
+}
+
+// whether the version in a stack name is version, which may leave off
+// the patch number.
+func versionMatches(stackName string, version string) bool {
+	m := stackVersionPattern.FindStringSubmatch(stackName)
+	if m == nil {
+		return false
+	}
+	full := m[1] + "." + m[2] + "." + m[3]
+	return full == version || m[1]+"."+m[2] == version
+}
+
+// turns an error from ResolveStack into the command's exit error,
+// listing the candidates on stderr when the reference was ambiguous.
+func resolutionExit(err error, ref string) error {
+	if amb, ok := err.(AmbiguousStackError); ok {
+		renderList(os.Stderr, amb.Candidates, stackColumns, "", "", true)
+		return cli.NewExitError(err.Error(), 1)
+	}
+	PrintTerminalError(err)
+	return cli.NewExitError("Unable to find the stack '"+ref+"'.", 1)
+}
+
+// the --namespace used to resolve stacks that are not given by guid.
+func stackNamespaceFlag(namespace *string) cli.Flag {
+	return cli.StringFlag{
+		Name:        "namespaces, namespace, ns, n",
+		Usage:       "Comma delimited namespaces to look for stacks in, when they are not given by GUID. Defaults to dev,qa,prod",
+		Destination: namespace,
+	}
+}
@@ -17,91 +17,237 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/getnelson/nelson/client"
 )
 
-func TestStackJsonUnmarshaling(t *testing.T) {
-	fixture := `
-    {
-      "workflow": "manual",
-      "guid": "1a69395e919d",
-      "stack_name": "dev-iptv-cass-dev--4-8-4--mtq2odqzndc0mg",
-      "deployed_at": 1468518896093,
-      "unit": "dev-iptv-cass-dev",
-      "type": "service"
-    }`
-
-	var result Stack
-	err := json.Unmarshal([]byte(fixture), &result)
-	if result.Workflow != "manual" {
-		t.Error("Should be able to parse JSON, but got error:\n", err)
+func TestUnseenLogLines(t *testing.T) {
+	logs := client.StackLog{Content: []string{"a", "b", "c", "d"}, Offset: 0}
+
+	// server ignored the offset and sent everything again
+	got := unseenLogLines(2, logs)
+	want := client.StackLog{Content: []string{"c", "d"}, Offset: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// server honoured the offset
+	honoured := client.StackLog{Content: []string{"c", "d"}, Offset: 2}
+	if got := unseenLogLines(2, honoured); !reflect.DeepEqual(got, honoured) {
+		t.Errorf("expected %v, got %v", honoured, got)
+	}
+
+	// nothing new
+	got = unseenLogLines(4, logs)
+	if len(got.Content) != 0 || got.Offset != 4 {
+		t.Errorf("expected no lines at offset 4, got %v", got)
+	}
+}
+
+func TestTailLogLines(t *testing.T) {
+	logs := client.StackLog{Content: []string{"a", "b", "c", "d"}, Offset: 10}
+
+	got := tailLogLines(2, logs)
+	want := client.StackLog{Content: []string{"c", "d"}, Offset: 12}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if got := tailLogLines(0, logs); !reflect.DeepEqual(got, logs) {
+		t.Errorf("expected tail of 0 to keep everything, got %v", got)
+	}
+	if got := tailLogLines(10, logs); !reflect.DeepEqual(got, logs) {
+		t.Errorf("expected a large tail to keep everything, got %v", got)
 	}
 }
 
-func TestStackSummaryJsonUnmarshaling(t *testing.T) {
-	fixture := `
-  {
-  "workflow": "pulsar",
-  "guid": "e4184c271bb9",
-  "statuses": [
-    {
-      "timestamp": "2016-07-14T22:30:22.358Z",
-      "message": "foo deployed to sacremento",
-      "status": "ready"
-    },
-    {
-      "timestamp": "2016-07-14T22:30:22.310Z",
-      "message": "writing alert definitions to sacremento's consul",
-      "status": "deploying"
-    },
-    {
-      "timestamp": "2016-07-14T22:30:22.264Z",
-      "message": "waiting for the application to become ready",
-      "status": "deploying"
-    },
-    {
-      "timestamp": "2016-07-14T22:30:21.421Z",
-      "message": "instructing sacremento's marathon to launch container",
-      "status": "deploying"
-    },
-    {
-      "timestamp": "2016-07-14T22:29:44.370Z",
-      "message": "replicating registry.yourcompany.com/units/foo-2.0:2.0.11 to remote registry",
-      "status": "deploying"
-    },
-    {
-      "timestamp": "2016-07-14T22:29:44.323Z",
-      "message": "",
-      "status": "pending"
-    }
-  ],
-  "stack_name": "foo--2-0-11--8gufie2b",
-  "deployed_at": 1468535384221,
-  "unit": "foo",
-  "expiration": 1469928212871,
-  "dependencies": {
-    "outbound": [
-      {
-        "workflow": "manual",
-        "guid": "1a69395e919d",
-        "stack_name": "dev-cass-dev--4-8-4--mtq2odqzndc0mg",
-        "deployed_at": 1468518896093,
-        "unit": "dev-cass-dev",
-        "type": "service"
-      }
-    ],
-    "inbound": []
-  },
-  "namespace": "dev"
-}`
-
-	var result StackSummary
-	err := json.Unmarshal([]byte(fixture), &result)
-
-	t.Log(result.Dependencies.Outbound)
-
-	if len(result.Dependencies.Outbound) != 1 {
-		t.Error("Should have had one outbound dependency, but got error:\n", err)
+func TestIsTerminalStatus(t *testing.T) {
+	for _, s := range []string{"ready", "failed", "terminated"} {
+		if !isTerminalStatus(s) {
+			t.Errorf("expected '%s' to be terminal", s)
+		}
+	}
+	for _, s := range []string{"pending", "deploying", "warming"} {
+		if isTerminalStatus(s) {
+			t.Errorf("expected '%s' not to be terminal", s)
+		}
+	}
+}
+
+func TestUnseenStatuses(t *testing.T) {
+	seen := map[client.StackStatus]bool{}
+	pending := client.StackStatus{Timestamp: "2017-01-01T00:00:00Z", Status: "pending"}
+	deploying := client.StackStatus{Timestamp: "2017-01-01T00:01:00Z", Status: "deploying"}
+
+	// newest first, as the server sends them
+	got := unseenStatuses(seen, []client.StackStatus{deploying, pending})
+	if !reflect.DeepEqual(got, []client.StackStatus{pending, deploying}) {
+		t.Errorf("expected statuses oldest first, got %v", got)
+	}
+	if got := unseenStatuses(seen, []client.StackStatus{deploying, pending}); len(got) != 0 {
+		t.Errorf("expected no new statuses, got %v", got)
+	}
+}
+
+func TestWaitForStack(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/runtime") {
+			polls++
+			if polls < 3 {
+				w.Write([]byte(`{"current_status": "deploying"}`))
+			} else {
+				w.Write([]byte(`{"current_status": "failed"}`))
+			}
+			return
+		}
+		w.Write([]byte(`{"guid": "abc", "statuses": [{"status": "pending", "timestamp": "2017-01-01T00:00:00Z"}]}`))
+	}))
+	defer server.Close()
+
+	c := client.New(server.URL, client.Session{})
+	emitted := 0
+	status, err := WaitForStack(context.Background(), c, "abc", "ready", time.Millisecond, time.Millisecond, func(client.StackStatus) { emitted++ })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status != "failed" || polls != 3 || emitted != 1 {
+		t.Errorf("expected to stop on failed after 3 polls with 1 status, got %s after %d with %d", status, polls, emitted)
+	}
+}
+
+// a nelson whose deployment log gains a line on every read, honouring
+// the offset it is asked for, and whose stack is deploying until status
+// says otherwise.
+func followServer(status func(polls int) string, offsets *[]string) *httptest.Server {
+	var mu sync.Mutex
+	polls := 0
+	lines := []string{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/runtime") {
+			polls++
+			w.Write([]byte(`{"current_status": "` + status(polls) + `"}`))
+			return
+		}
+		*offsets = append(*offsets, r.URL.Query().Get("offset"))
+		lines = append(lines, fmt.Sprintf("line %d", len(lines)))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		body, _ := json.Marshal(client.StackLog{Content: lines[offset:], Offset: offset})
+		w.Write(body)
+	}))
+}
+
+func TestFollowDeploymentLog(t *testing.T) {
+	var offsets []string
+	server := followServer(func(polls int) string {
+		if polls < 3 {
+			return "deploying"
+		}
+		return "ready"
+	}, &offsets)
+	defer server.Close()
+
+	emitted := []string{}
+	status, err := FollowDeploymentLog(context.Background(), client.New(server.URL, client.Session{}), "abc", 0, 0, time.Millisecond, func(l client.StackLog) {
+		emitted = append(emitted, l.Content...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "ready" {
+		t.Errorf("expected to stop once the stack was ready, got %s", status)
+	}
+	// the first read is from the start, then each picks up after the last
+	if strings.Join(offsets, ",") != ",1,2" {
+		t.Errorf("expected the offset to advance, got %v", offsets)
+	}
+	if strings.Join(emitted, ",") != "line 0,line 1,line 2" {
+		t.Errorf("expected every line exactly once, got %v", emitted)
+	}
+}
+
+func TestFollowDeploymentLogStopsWhenCancelled(t *testing.T) {
+	var offsets []string
+	server := followServer(func(int) string { return "deploying" }, &offsets)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reads := 0
+	_, err := FollowDeploymentLog(ctx, client.New(server.URL, client.Session{}), "abc", 0, 0, time.Hour, func(client.StackLog) {
+		if reads++; reads == 1 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("expected the follow to stop when cancelled, got %v", err)
+	}
+	if reads != 1 {
+		t.Errorf("expected no reads after cancelling, got %d", reads)
+	}
+}
+
+func TestResolveStack(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		w.Write([]byte(`[
+			{"guid": "a1b2c3d4e5f6", "stack_name": "howdy-http--1-2-3--aaaa", "unit": "howdy-http"},
+			{"guid": "a1b2ffffffff", "stack_name": "howdy-http--1-2-4--bbbb", "unit": "howdy-http"},
+			{"guid": "0123456789ab", "stack_name": "howdy-batch--2-0-0--cccc", "unit": "howdy-batch"},
+			{"guid": "9876543210ab", "stack_name": "howdy-batch--2-0-0--dddd", "unit": "howdy-batch", "status": "terminated"},
+			{"guid": "5555aaaa5555", "stack_name": "manual-db--1-0-0--eeee", "unit": "manual-db", "status": "manual"}
+		]`))
+	}))
+	defer server.Close()
+	c := client.New(server.URL, client.Session{})
+
+	resolved := map[string]string{
+		"0123456789ab":            "0123456789ab", // a full guid needs no lookup
+		"a1b2c3":                  "a1b2c3d4e5f6",
+		"howdy-http--1-2-4--bbbb": "a1b2ffffffff",
+		"howdy-batch@2.0.0":       "0123456789ab",
+		"howdy-http@1.2.3":        "a1b2c3d4e5f6",
+		"manual-db--1-0-0--eeee":  "5555aaaa5555",
+	}
+	for ref, want := range resolved {
+		got, err := ResolveStack(context.Background(), c, ref, "qa")
+		if err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s (%v)", ref, want, got, err)
+		}
+	}
+	if len(requests) != len(resolved)-1 || !strings.Contains(requests[0], "ns=qa") {
+		t.Errorf("unexpected requests %v", requests)
+	}
+	for _, status := range knownStackStatuses {
+		if !strings.Contains(requests[0], status) {
+			t.Errorf("expected stacks that are %s to be searched, got %s", status, requests[0])
+		}
+	}
+
+	_, err := ResolveStack(context.Background(), c, "howdy-http@1.2", "")
+	amb, ok := err.(AmbiguousStackError)
+	if !ok || len(amb.Candidates) != 2 {
+		t.Errorf("expected two candidates, got %v", err)
+	}
+	if _, err := ResolveStack(context.Background(), c, "a1b2", ""); err == nil {
+		t.Error("expected an ambiguous prefix to fail")
+	}
+	for _, ref := range []string{"a1b", "ffff", "howdy-http@9.9"} {
+		if _, err := ResolveStack(context.Background(), c, ref, ""); err == nil {
+			t.Errorf("%s: expected no match", ref)
+		}
 	}
 }
@@ -0,0 +1,341 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/getnelson/nelson/client"
+)
+
+// how many characters wide the gantt bars are drawn
+const timelineWidth = 40
+
+/*
+ * {
+ *   "guid": "b8ff485a0306",
+ *   "stack_name": "howdy-http--1-2-3--b8ff485a",
+ *   "unit": "howdy-http",
+ *   "namespace": "dev",
+ *   "deployed_at": 1467225866870,
+ *   "phases": [
+ *     { "status": "pending", "started_at": 1467225866870, "duration_seconds": 4, "updates": 1 },
+ *     { "status": "deploying", "started_at": 1467225870870, "duration_seconds": 62, "updates": 3 },
+ *     { "status": "warming", "started_at": 1467225932870, "duration_seconds": 180, "updates": 1 },
+ *     { "status": "ready", "started_at": 1467226112870, "duration_seconds": 86400, "updates": 1, "current": true }
+ *   ],
+ *   "ready": true,
+ *   "ready_after_seconds": 246,
+ *   "gaps": [
+ *     { "status": "warming", "from": 1467225932870, "to": 1467226112870, "duration_seconds": 180 }
+ *   ]
+ * }
+ */
+type StackTimeline struct {
+	Guid              string          `json:"guid"`
+	StackName         string          `json:"stack_name"`
+	Unit              string          `json:"unit"`
+	Namespace         string          `json:"namespace"`
+	DeployedAt        int64           `json:"deployed_at"`
+	Phases            []TimelinePhase `json:"phases"`
+	Ready             bool            `json:"ready"`
+	ReadyAfterSeconds float64         `json:"ready_after_seconds"`
+	Gaps              []TimelineGap   `json:"gaps"`
+}
+
+// TimelinePhase is a run of consecutive status updates with the same
+// status. The phase the stack is in now is Current, and its duration is
+// measured up to the time the timeline was built.
+type TimelinePhase struct {
+	Status          string  `json:"status"`
+	StartedAt       int64   `json:"started_at"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Updates         int     `json:"updates"`
+	Current         bool    `json:"current,omitempty"`
+}
+
+// TimelineGap is a stretch with no status updates at all, reported
+// against the status the stack was in at the time.
+type TimelineGap struct {
+	Status          string  `json:"status"`
+	From            int64   `json:"from"`
+	To              int64   `json:"to"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// BuildTimeline orders the status history of a stack and folds it into
+// phases. Time to ready is measured from the first status update to the
+// first ready one, and any silence between updates of at least gap is
+// reported; a gap of zero reports none.
+func BuildTimeline(s client.StackSummary, gap time.Duration) (StackTimeline, error) {
+	t := StackTimeline{
+		Guid:       s.Guid,
+		StackName:  s.StackName,
+		Unit:       s.UnitName,
+		Namespace:  s.NamespaceRef,
+		DeployedAt: s.DeployedAt,
+		Phases:     []TimelinePhase{},
+		Gaps:       []TimelineGap{},
+	}
+
+	type update struct {
+		status string
+		at     int64
+	}
+	updates := make([]update, 0, len(s.Statuses))
+	for _, st := range s.Statuses {
+		at, err := time.Parse(time.RFC3339Nano, st.Timestamp)
+		if err != nil {
+			return t, fmt.Errorf("stack %s has a status update with an unreadable timestamp '%s'", s.Guid, st.Timestamp)
+		}
+		updates = append(updates, update{st.Status, at.UnixNano() / int64(time.Millisecond)})
+	}
+	// nelson lists the newest update first
+	sort.SliceStable(updates, func(i, j int) bool { return updates[i].at < updates[j].at })
+
+	for i, u := range updates {
+		if n := len(t.Phases); n > 0 && t.Phases[n-1].Status == u.status {
+			t.Phases[n-1].Updates++
+		} else {
+			t.Phases = append(t.Phases, TimelinePhase{Status: u.status, StartedAt: u.at, Updates: 1})
+		}
+		if u.status == "ready" && !t.Ready {
+			t.Ready = true
+			t.ReadyAfterSeconds = millisToSeconds(u.at - updates[0].at)
+		}
+		if i > 0 && gap > 0 && u.at-updates[i-1].at >= int64(gap/time.Millisecond) {
+			t.Gaps = append(t.Gaps, TimelineGap{
+				Status:          updates[i-1].status,
+				From:            updates[i-1].at,
+				To:              u.at,
+				DurationSeconds: millisToSeconds(u.at - updates[i-1].at),
+			})
+		}
+	}
+	for i := range t.Phases {
+		if i+1 < len(t.Phases) {
+			t.Phases[i].DurationSeconds = millisToSeconds(t.Phases[i+1].StartedAt - t.Phases[i].StartedAt)
+		} else {
+			t.Phases[i].Current = true
+			t.Phases[i].DurationSeconds = millisToSeconds(currentTimeMillis() - t.Phases[i].StartedAt)
+		}
+	}
+	return t, nil
+}
+
+// StackTimelines builds the timeline of each stack, oldest deployment
+// first so that comparisons read in the order the stacks were deployed.
+func StackTimelines(ctx context.Context, c *client.Client, guids []string, gap time.Duration) ([]StackTimeline, error) {
+	out := []StackTimeline{}
+	for _, guid := range guids {
+		s, err := c.InspectStack(ctx, guid)
+		if err != nil {
+			return nil, err
+		}
+		t, err := BuildTimeline(s, gap)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].DeployedAt < out[j].DeployedAt })
+	return out, nil
+}
+
+// RecentStacksOfUnit returns the guids of the last stacks of a unit to
+// be deployed, newest first.
+func RecentStacksOfUnit(ctx context.Context, c *client.Client, unit string, namespaces string, last int) ([]string, error) {
+	stacks, err := c.ListStacks(ctx, "", namespaces, "", unit)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(stacks, func(i, j int) bool { return stacks[i].DeployedAt > stacks[j].DeployedAt })
+	guids := []string{}
+	for _, s := range stacks {
+		if s.UnitName != unit {
+			continue
+		}
+		if len(guids) == last {
+			break
+		}
+		guids = append(guids, s.Guid)
+	}
+	return guids, nil
+}
+
+func millisToSeconds(ms int64) float64 {
+	return float64(ms) / 1000
+}
+
+func formatSeconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(time.Second).String()
+}
+
+// ganttBar draws where a phase falls between the first status update and
+// the start of the current phase. The current phase has no end yet, so
+// it is drawn as a single marker where it began.
+func ganttBar(t StackTimeline, p TimelinePhase) string {
+	first := t.Phases[0].StartedAt
+	span := t.Phases[len(t.Phases)-1].StartedAt - first
+	position := func(at int64) int {
+		if span <= 0 {
+			return 0
+		}
+		return int((at - first) * timelineWidth / span)
+	}
+
+	from := position(p.StartedAt)
+	if p.Current {
+		if from >= timelineWidth {
+			from = timelineWidth - 1
+		}
+		return strings.Repeat(".", from) + ">" + strings.Repeat(".", timelineWidth-from-1)
+	}
+	to := position(p.StartedAt + int64(p.DurationSeconds*1000))
+	if to <= from {
+		to = from + 1
+	}
+	if to > timelineWidth {
+		to = timelineWidth
+	}
+	return strings.Repeat(".", from) + strings.Repeat("#", to-from) + strings.Repeat(".", timelineWidth-to)
+}
+
+func PrintStackTimeline(t StackTimeline) {
+	fmt.Println("===>> Timeline of " + t.StackName + " (" + t.Guid + ")")
+	if len(t.Phases) == 0 {
+		fmt.Println("no status updates have been recorded")
+		return
+	}
+	var tabulized = [][]string{}
+	for _, p := range t.Phases {
+		duration := formatSeconds(p.DurationSeconds)
+		if p.Current {
+			duration = duration + " (current)"
+		}
+		tabulized = append(tabulized, []string{p.Status, JavaEpochToDateStr(p.StartedAt), duration, fmt.Sprintf("%d", p.Updates), ganttBar(t, p)})
+	}
+	RenderTableToStdout([]string{"Phase", "Started", "Duration", "Updates", "Timeline"}, tabulized)
+
+	fmt.Println("")
+	if t.Ready {
+		fmt.Println("===>> Ready after " + formatSeconds(t.ReadyAfterSeconds))
+	} else {
+		fmt.Println("===>> Not ready yet")
+	}
+
+	if len(t.Gaps) > 0 {
+		fmt.Println("")
+		fmt.Println("===>> Gaps in status updates")
+		var gaps = [][]string{}
+		for _, g := range t.Gaps {
+			gaps = append(gaps, []string{g.Status, JavaEpochToDateStr(g.From), JavaEpochToDateStr(g.To), formatSeconds(g.DurationSeconds)})
+		}
+		RenderTableToStdout([]string{"During", "From", "To", "Duration"}, gaps)
+	}
+}
+
+// phaseTotals adds up how long a stack spent in each status it has left
+// behind; the current phase is still running and so is not counted.
+func phaseTotals(t StackTimeline) map[string]float64 {
+	totals := map[string]float64{}
+	for _, p := range t.Phases {
+		if !p.Current {
+			totals[p.Status] += p.DurationSeconds
+		}
+	}
+	return totals
+}
+
+func median(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, xs...)
+	sort.Float64s(sorted)
+	if len(sorted)%2 == 1 {
+		return sorted[len(sorted)/2]
+	}
+	return (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+}
+
+// regression marks a duration more than half as long again as the median
+// of the stacks being compared.
+func regression(value float64, m float64) string {
+	if m <= 0 || value <= m*1.5 {
+		return ""
+	}
+	return color.New(color.FgYellow).SprintFunc()(fmt.Sprintf(" (+%.0f%%)", (value/m-1)*100))
+}
+
+// PrintTimelineComparison shows one row per stack with the time spent in
+// each phase and the time to ready, flagging any that are well over the
+// median of the stacks compared.
+func PrintTimelineComparison(ts []StackTimeline) {
+	statuses := []string{}
+	seen := map[string]bool{}
+	totals := make([]map[string]float64, len(ts))
+	samples := map[string][]float64{}
+	readies := []float64{}
+	for i, t := range ts {
+		totals[i] = phaseTotals(t)
+		for _, p := range t.Phases {
+			if !p.Current && !seen[p.Status] {
+				seen[p.Status] = true
+				statuses = append(statuses, p.Status)
+			}
+		}
+		for status, d := range totals[i] {
+			samples[status] = append(samples[status], d)
+		}
+		if t.Ready {
+			readies = append(readies, t.ReadyAfterSeconds)
+		}
+	}
+
+	headers := []string{"GUID", "Stack", "Deployed At"}
+	for _, s := range statuses {
+		headers = append(headers, s)
+	}
+	headers = append(headers, "Ready After")
+
+	var tabulized = [][]string{}
+	for i, t := range ts {
+		row := []string{t.Guid, truncateString(t.StackName, 55), JavaEpochToDateStr(t.DeployedAt)}
+		for _, s := range statuses {
+			d, ok := totals[i][s]
+			if !ok {
+				row = append(row, "-")
+				continue
+			}
+			row = append(row, formatSeconds(d)+regression(d, median(samples[s])))
+		}
+		if t.Ready {
+			row = append(row, formatSeconds(t.ReadyAfterSeconds)+regression(t.ReadyAfterSeconds, median(readies)))
+		} else {
+			row = append(row, "-")
+		}
+		tabulized = append(tabulized, row)
+	}
+	fmt.Println("===>> Phase durations, oldest deployment first")
+	RenderTableToStdout(headers, tabulized)
+}
@@ -0,0 +1,91 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	s := client.StackSummary{
+		Guid: "b8ff485a0306",
+		// newest first, as nelson returns them
+		Statuses: []client.StackStatus{
+			{Status: "ready", Timestamp: "2017-06-01T10:10:00Z"},
+			{Status: "warming", Timestamp: "2017-06-01T10:02:00Z"},
+			{Status: "deploying", Timestamp: "2017-06-01T10:01:00Z"},
+			{Status: "deploying", Timestamp: "2017-06-01T10:00:10Z"},
+			{Status: "pending", Timestamp: "2017-06-01T10:00:00.000Z"},
+		},
+	}
+	tl, err := BuildTimeline(s, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		status   string
+		duration float64
+		updates  int
+	}{{"pending", 10, 1}, {"deploying", 110, 2}, {"warming", 480, 1}}
+	if len(tl.Phases) != 4 {
+		t.Fatalf("expected 4 phases, got %+v", tl.Phases)
+	}
+	for i, e := range expected {
+		p := tl.Phases[i]
+		if p.Status != e.status || p.DurationSeconds != e.duration || p.Updates != e.updates || p.Current {
+			t.Errorf("phase %d: expected %+v, got %+v", i, e, p)
+		}
+	}
+	if !tl.Phases[3].Current || tl.Phases[3].Status != "ready" {
+		t.Errorf("expected to be ready now, got %+v", tl.Phases[3])
+	}
+	if !tl.Ready || tl.ReadyAfterSeconds != 600 {
+		t.Errorf("expected ready after 600s, got %v %v", tl.Ready, tl.ReadyAfterSeconds)
+	}
+	if len(tl.Gaps) != 1 || tl.Gaps[0].Status != "warming" || tl.Gaps[0].DurationSeconds != 480 {
+		t.Errorf("expected the silence while warming to be a gap, got %+v", tl.Gaps)
+	}
+
+	bars := []string{}
+	for _, p := range tl.Phases {
+		bars = append(bars, ganttBar(tl, p))
+	}
+	if !strings.HasPrefix(bars[2], strings.Repeat(".", 8)+"#") || !strings.HasSuffix(bars[2], "#") {
+		t.Errorf("expected warming to run from 20%% to the end, got %s", bars[2])
+	}
+	if bars[3] != strings.Repeat(".", timelineWidth-1)+">" {
+		t.Errorf("expected a marker for the current phase, got %s", bars[3])
+	}
+
+	if _, err := BuildTimeline(client.StackSummary{Statuses: []client.StackStatus{{Timestamp: "yesterday"}}}, 0); err == nil {
+		t.Error("expected an unreadable timestamp to be an error")
+	}
+}
+
+func TestTimelineRegression(t *testing.T) {
+	if regression(100, median([]float64{100, 110, 90})) != "" {
+		t.Error("did not expect a duration close to the median to be flagged")
+	}
+	if r := regression(300, median([]float64{100, 110, 300})); !strings.Contains(r, "+173%") {
+		t.Errorf("expected a regression to be flagged, got %q", r)
+	}
+}
@@ -17,172 +17,300 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
-	"github.com/parnurzeal/gorequest"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/getnelson/nelson/client"
 )
 
-/*
- * {
- *   "guid": "3fbc7381a664",
- *   "namespace": "dev",
- *   "service_type": "heydiddlyho-http",
- *   "version": {
- *     "major": 0,
- *     "minor": 33
- *   }
- * }
- */
-type UnitSummary struct {
-	Guid         string         `json:"guid"`
-	NamespaceRef string         `json:"namespace"`
-	ServiceType  string         `json:"service_type"`
-	Version      FeatureVersion `json:"version"`
+var unitColumns = []Column{
+	{Name: "guid", Header: "GUID", Value: func(r interface{}) string { return r.(client.UnitSummary).Guid }},
+	{Name: "namespace", Header: "Namespace", Value: func(r interface{}) string { return r.(client.UnitSummary).NamespaceRef }},
+	{Name: "service_type", Header: "Unit", Value: func(r interface{}) string { return r.(client.UnitSummary).ServiceType }},
+	{Name: "version", Header: "Version", Value: func(r interface{}) string {
+		v := r.(client.UnitSummary).Version
+		return strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor)
+	}},
 }
 
-type FeatureVersion struct {
-	Major int `json:"major"`
-	Minor int `json:"minor"`
+func PrintListUnits(units []client.UnitSummary) {
+	RenderList(units, unitColumns)
 }
 
+/////////////////// INSPECT ///////////////////
+
 /*
  * {
- *   "policies": [ "foo", "bar", "baz" ]
+ *   "unit": "howdy-http",
+ *   "versions": [
+ *     {
+ *       "version": { "major": 1, "minor": 0 },
+ *       "namespace": "dev",
+ *       "datacenter": "texas",
+ *       "stacks": [ ... ]
+ *     }
+ *   ],
+ *   "loadbalancers": [ ... ],
+ *   "dependents": [ ... ]
  * }
  */
-type PolicyList struct {
-	Policies []string `json:"policies"`
+type UnitReport struct {
+	Unit          string                `json:"unit"`
+	Versions      []UnitVersionReport   `json:"versions"`
+	Loadbalancers []client.Loadbalancer `json:"loadbalancers"`
+	Dependents    []client.Stack        `json:"dependents"`
 }
 
-/////////////////// LIST ///////////////////
-
-func ListUnits(delimitedDcs string, delimitedNamespaces string, delimitedStatuses string, http *gorequest.SuperAgent, cfg *Config) (list []UnitSummary, err []error) {
-	uri := "/v1/units?"
-	// set the datacenters if specified
-	if isValidCommaDelimitedList(delimitedDcs) {
-		uri = uri + "dc=" + delimitedDcs + "&"
-	}
-	if isValidCommaDelimitedList(delimitedStatuses) {
-		uri = uri + "status=" + delimitedStatuses + "&"
-	} else {
-		// if the user didnt specify statuses, they probally only want ready units.
-		uri = uri + "status=ready,warming,manual&"
-	}
-	if isValidCommaDelimitedList(delimitedNamespaces) {
-		uri = uri + "ns=" + delimitedNamespaces
-	} else {
-		uri = uri + "ns=dev,qa,prod"
-	}
+// A feature version of the unit as deployed into one namespace of one
+// datacenter. Datacenter is empty for versions nelson knows about but
+// which have no live stacks.
+type UnitVersionReport struct {
+	Version      client.FeatureVersion `json:"version"`
+	NamespaceRef string                `json:"namespace"`
+	Datacenter   string                `json:"datacenter,omitempty"`
+	Stacks       []client.Stack        `json:"stacks"`
+}
 
-	r, bytes, errs := AugmentRequest(
-		http.Get(cfg.Endpoint+uri), cfg).EndBytes()
+// stack names take the form <unit>--<major>-<minor>-<patch>--<hash>
+var stackVersionPattern = regexp.MustCompile(`--(\d+)-(\d+)-(\d+)--[^-]+$`)
 
-	if errs != nil {
-		return nil, errs
+func stackFeatureVersion(stackName string) (client.FeatureVersion, bool) {
+	m := stackVersionPattern.FindStringSubmatch(stackName)
+	if m == nil {
+		return client.FeatureVersion{}, false
 	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return client.FeatureVersion{Major: major, Minor: minor}, true
+}
 
-	if r.StatusCode/100 != 2 {
-		errs = append(errs, errors.New("bad response from Nelson server"))
-		return nil, errs
-	} else {
-		var list []UnitSummary
-		if err := json.Unmarshal(bytes, &list); err != nil {
-			panic(err)
-		}
-		return list, errs
-	}
+func formatFeatureVersion(v client.FeatureVersion) string {
+	return strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor)
 }
 
-func PrintListUnits(units []UnitSummary) {
-	var tabulized = [][]string{}
-	for _, u := range units {
-		tabulized = append(tabulized, []string{u.Guid, u.NamespaceRef, u.ServiceType, strconv.Itoa(u.Version.Major) + "." + strconv.Itoa(u.Version.Minor)})
+func routesToUnit(lb client.Loadbalancer, unit string) bool {
+	for _, r := range lb.Routes {
+		if r.BackendName == unit {
+			return true
+		}
 	}
-
-	RenderTableToStdout([]string{"GUID", "Namespace", "Unit", "Version"}, tabulized)
+	return false
 }
 
-/////////////////// DEPRECATION ///////////////////
-
-/*
- * {
- *   "service_type": "heydiddlyho-http",
- *   "version":{
- *     "major":1,
- *     "minor":33
- *   }
- * }
- */
-type DeprecationExpiryRequest struct {
-	ServiceType string         `json:"service_type"`
-	Version     FeatureVersion `json:"version"`
-}
+// InspectUnit gathers every version of a unit, the stacks backing them,
+// the load balancers routing to it and the stacks depending on it. When
+// no datacenters or namespaces are given, all of those nelson knows
+// about are searched. The stacks are inspected for their dependents at
+// most concurrency at a time.
+func InspectUnit(ctx context.Context, c *client.Client, unit string, delimitedDcs string, delimitedNamespaces string, concurrency int) (UnitReport, error) {
+	report := UnitReport{Unit: unit, Versions: []UnitVersionReport{}, Loadbalancers: []client.Loadbalancer{}, Dependents: []client.Stack{}}
 
-func Deprecate(req DeprecationExpiryRequest, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-	r, body, errs := AugmentRequest(
-		http.Post(cfg.Endpoint+"/v1/units/deprecate"), cfg).Send(req).EndBytes()
+	dcs := []string{}
+	nss := []string{}
+	if delimitedDcs == "" || delimitedNamespaces == "" {
+		all, err := c.ListDatacenters(ctx)
+		if err != nil {
+			return report, err
+		}
+		seen := map[string]bool{}
+		for _, dc := range all {
+			dcs = append(dcs, dc.Name)
+			for _, ns := range dc.Namespaces {
+				if !seen[ns.Name] {
+					seen[ns.Name] = true
+					nss = append(nss, ns.Name)
+				}
+			}
+		}
+	}
+	if delimitedDcs != "" {
+		dcs = strings.Split(delimitedDcs, ",")
+	}
+	if delimitedNamespaces != "" {
+		nss = strings.Split(delimitedNamespaces, ",")
+	}
+	nsList := strings.Join(nss, ",")
 
-	if errs != nil {
-		return "", errs
+	//>>>>>>>>>>> versions and their stacks
+	versions := map[string]*UnitVersionReport{}
+	version := func(v client.FeatureVersion, ns string, dc string) *UnitVersionReport {
+		key := formatFeatureVersion(v) + "/" + ns + "/" + dc
+		if versions[key] == nil {
+			versions[key] = &UnitVersionReport{Version: v, NamespaceRef: ns, Datacenter: dc, Stacks: []client.Stack{}}
+		}
+		return versions[key]
 	}
 
-	if r.StatusCode/100 != 2 {
-		resp := string(body[:])
-		errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		return resp, errs
-	} else {
-		return "Requested deprecation of " + req.ServiceType + " " + strconv.Itoa(req.Version.Major) + "." + strconv.Itoa(req.Version.Minor), errs
+	ownStacks := map[string]bool{}
+	stacks := []client.Stack{}
+	for _, dc := range dcs {
+		list, err := c.ListStacks(ctx, dc, nsList, "", unit)
+		if err != nil {
+			return report, err
+		}
+		for _, s := range list {
+			v, ok := stackFeatureVersion(s.StackName)
+			if !ok {
+				continue
+			}
+			vr := version(v, s.NamespaceRef, dc)
+			vr.Stacks = append(vr.Stacks, s)
+			ownStacks[s.Guid] = true
+			stacks = append(stacks, s)
+		}
 	}
-}
 
-/////////////////// EXPIRATION ///////////////////
+	units, err := c.ListUnits(ctx, strings.Join(dcs, ","), nsList, "")
+	if err != nil {
+		return report, err
+	}
+	for _, u := range units {
+		if u.ServiceType != unit {
+			continue
+		}
+		known := false
+		for _, vr := range versions {
+			if vr.Version == u.Version && vr.NamespaceRef == u.NamespaceRef {
+				known = true
+			}
+		}
+		if !known {
+			version(u.Version, u.NamespaceRef, "")
+		}
+	}
 
-func Expire(req DeprecationExpiryRequest, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-	r, body, errs := AugmentRequest(
-		http.Post(cfg.Endpoint+"/v1/units/expire"), cfg).Send(req).EndBytes()
+	for _, vr := range versions {
+		report.Versions = append(report.Versions, *vr)
+	}
+	sort.Slice(report.Versions, func(i, j int) bool {
+		a, b := report.Versions[i], report.Versions[j]
+		if a.Version != b.Version {
+			return a.Version.Major > b.Version.Major || (a.Version.Major == b.Version.Major && a.Version.Minor > b.Version.Minor)
+		}
+		if a.NamespaceRef != b.NamespaceRef {
+			return a.NamespaceRef < b.NamespaceRef
+		}
+		return a.Datacenter < b.Datacenter
+	})
 
-	if errs != nil {
-		return "", errs
+	//>>>>>>>>>>> load balancers
+	lbs, err := c.ListLoadbalancers(ctx, strings.Join(dcs, ","), nsList)
+	if err != nil {
+		return report, err
+	}
+	for _, lb := range lbs {
+		if routesToUnit(lb, unit) {
+			report.Loadbalancers = append(report.Loadbalancers, lb)
+		}
 	}
 
-	if r.StatusCode/100 != 2 {
-		resp := string(body[:])
-		errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		return resp, errs
-	} else {
-		return "Requested expiration of " + req.ServiceType + " " + strconv.Itoa(req.Version.Major) + "." + strconv.Itoa(req.Version.Minor), errs
+	//>>>>>>>>>>> inbound dependents
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	summaries := make([]client.StackSummary, len(stacks))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, concurrency)
+	for i, s := range stacks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, guid string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			summary, err := c.InspectStack(ctx, guid)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+			summaries[i] = summary
+		}(i, s.Guid)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return report, firstErr
 	}
-}
 
-/////////////////// COMMITING ///////////////////
+	// in the order the stacks were listed, so the report is stable
+	dependents := map[string]bool{}
+	for _, summary := range summaries {
+		for _, w := range summary.Dependencies.Inbound {
+			if !ownStacks[w.Guid] && !dependents[w.Guid] {
+				dependents[w.Guid] = true
+				report.Dependents = append(report.Dependents, w)
+			}
+		}
+	}
 
-/*
-* {
-*   "unit": "foo",
-*   "version": "1.2.3",
-*   "target": "qa"
-* }
- */
-type CommitRequest struct {
-	UnitName string `json:"unit"`
-	Version  string `json:"version"`
-	Target   string `json:"target"`
+	return report, nil
 }
 
-func CommitUnit(req CommitRequest, http *gorequest.SuperAgent, cfg *Config) (str string, err []error) {
-	r, body, errs := AugmentRequest(
-		http.Post(cfg.Endpoint+"/v1/units/commit"), cfg).Send(req).EndBytes()
+func PrintInspectUnit(r UnitReport) {
+	fmt.Println("===>> Versions")
+	var versions = [][]string{}
+	for _, v := range r.Versions {
+		if len(v.Stacks) == 0 {
+			versions = append(versions, []string{formatFeatureVersion(v.Version), v.NamespaceRef, v.Datacenter, "-", "-", "-", "-"})
+		}
+		for _, s := range v.Stacks {
+			versions = append(versions, []string{formatFeatureVersion(v.Version), v.NamespaceRef, v.Datacenter, s.Guid, truncateString(s.StackName, 55), s.Status, javaEpochToHumanizedTime(s.DeployedAt)})
+		}
+	}
+	RenderTableToStdout([]string{"Version", "Namespace", "Datacenter", "GUID", "Stack", "Status", "Deployed At"}, versions)
 
-	if errs != nil {
-		return "", errs
+	fmt.Println("") // give us a new line for spacing
+	fmt.Println("===>> Load Balancers")
+	var lbs = [][]string{}
+	for _, lb := range r.Loadbalancers {
+		routes := []string{}
+		for _, rt := range lb.Routes {
+			if rt.BackendName == r.Unit {
+				routes = append(routes, strconv.Itoa(rt.LBPort)+" ~> "+rt.BackendPortReference)
+			}
+		}
+		lbs = append(lbs, []string{lb.Guid, lb.Name, lb.Datacenter, lb.Namespace, strings.Join(routes, ", ")})
 	}
+	RenderTableToStdout([]string{"GUID", "Name", "Datacenter", "Namespace", "Routes"}, lbs)
 
-	if r.StatusCode/100 != 2 {
-		resp := string(body[:])
-		errs = append(errs, errors.New("Unexpected response from Nelson server"))
-		return resp, errs
-	} else {
-		return "Requested commit of " + req.UnitName + "@" + req.Version + " has failed.", errs
+	fmt.Println("") // give us a new line for spacing
+	fmt.Println("===>> Dependents")
+	var dependents = [][]string{}
+	for _, d := range r.Dependents {
+		dependents = append(dependents, []string{d.Guid, d.StackName, d.Type, d.NamespaceRef})
+	}
+	RenderTableToStdout([]string{"GUID", "Stack", "Type", "Namespace"}, dependents)
+}
+
+// DescribeUnitVersion looks up where a unit version is deployed for a
+// confirmation prompt.
+func DescribeUnitVersion(ctx context.Context, c *client.Client, unit string, version client.FeatureVersion) ([][]string, error) {
+	units, err := c.ListUnits(ctx, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	namespaces := []string{}
+	for _, u := range units {
+		if u.ServiceType == unit && u.Version == version {
+			namespaces = append(namespaces, u.NamespaceRef)
+		}
+	}
+	deployed := strings.Join(namespaces, ", ")
+	if deployed == "" {
+		deployed = "none found"
 	}
+	return [][]string{
+		{"Unit", unit},
+		{"Version", formatFeatureVersion(version)},
+		{"Namespaces", deployed},
+	}, nil
 }
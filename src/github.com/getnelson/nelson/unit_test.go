@@ -0,0 +1,146 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//:
+//:   Licensed under the Apache License, Version 2.0 (the "License");
+//:   you may not use this file except in compliance with the License.
+//:   You may obtain a copy of the License at
+//:
+//:       http://www.apache.org/licenses/LICENSE-2.0
+//:
+//:   Unless required by applicable law or agreed to in writing, software
+//:   distributed under the License is distributed on an "AS IS" BASIS,
+//:   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//:   See the License for the specific language governing permissions and
+//:   limitations under the License.
+//:
+//: ----------------------------------------------------------------------------
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getnelson/nelson/client"
+)
+
+func TestStackFeatureVersion(t *testing.T) {
+	v, ok := stackFeatureVersion("howdy-http--1-12-344--9uuu9j4h")
+	if !ok || v != (client.FeatureVersion{Major: 1, Minor: 12}) {
+		t.Errorf("expected 1.12, got %v (%v)", v, ok)
+	}
+	// unit names may themselves contain dashes and digits
+	v, ok = stackFeatureVersion("s3-2-proxy--0-3-1--kbqg9nff")
+	if !ok || v != (client.FeatureVersion{Major: 0, Minor: 3}) {
+		t.Errorf("expected 0.3, got %v (%v)", v, ok)
+	}
+	if _, ok := stackFeatureVersion("some-manual-stack"); ok {
+		t.Error("expected a name without a version not to parse")
+	}
+}
+
+func TestRoutesToUnit(t *testing.T) {
+	lb := client.Loadbalancer{Routes: []client.LoadbalancerRoute{{BackendName: "howdy-http", LBPort: 8444}}}
+	if !routesToUnit(lb, "howdy-http") {
+		t.Error("expected the load balancer to route to howdy-http")
+	}
+	if routesToUnit(lb, "howdy") {
+		t.Error("expected the load balancer not to route to howdy")
+	}
+}
+
+// a nelson holding two stacks of howdy-http in dev, each with inbound
+// dependents, one of which depends on both; failing names a stack whose
+// inspection fails.
+func unitServer(t *testing.T, failing string, inFlight *int, most *int) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/deployments":
+			w.Write([]byte(`[
+				{"guid": "aaaaaaaaaaaa", "stack_name": "howdy-http--1-2-3--aaaa", "unit": "howdy-http", "namespace": "dev"},
+				{"guid": "bbbbbbbbbbbb", "stack_name": "howdy-http--1-3-0--bbbb", "unit": "howdy-http", "namespace": "dev"}
+			]`))
+		case r.URL.Path == "/v1/units":
+			w.Write([]byte(`[{"guid": "u1", "namespace": "dev", "service_type": "howdy-http", "version": {"major": 0, "minor": 9}}]`))
+		case r.URL.Path == "/v1/loadbalancers":
+			w.Write([]byte(`[
+				{"guid": "lb1", "name": "howdy-lb", "routes": [{"backend_name": "howdy-http", "backend_port_reference": "default", "lb_port": 80}]},
+				{"guid": "lb2", "name": "other-lb", "routes": [{"backend_name": "other", "backend_port_reference": "default", "lb_port": 80}]}
+			]`))
+		case strings.HasPrefix(r.URL.Path, "/v1/deployments/"):
+			mu.Lock()
+			*inFlight++
+			if *inFlight > *most {
+				*most = *inFlight
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			*inFlight--
+			mu.Unlock()
+
+			guid := strings.TrimPrefix(r.URL.Path, "/v1/deployments/")
+			if guid == failing {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			inbound := `{"guid": "cccccccccccc", "stack_name": "web--1-0-0--cccc"}`
+			if guid == "bbbbbbbbbbbb" {
+				inbound += `, {"guid": "dddddddddddd", "stack_name": "batch--1-0-0--dddd"}, {"guid": "aaaaaaaaaaaa", "stack_name": "howdy-http--1-2-3--aaaa"}`
+			}
+			w.Write([]byte(`{"guid": "` + guid + `", "dependencies": {"inbound": [` + inbound + `], "outbound": []}}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	}))
+}
+
+func TestInspectUnit(t *testing.T) {
+	inFlight, most := 0, 0
+	server := unitServer(t, "", &inFlight, &most)
+	defer server.Close()
+
+	r, err := InspectUnit(context.Background(), client.New(server.URL, client.Session{}), "howdy-http", "texas", "dev", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := []string{}
+	for _, v := range r.Versions {
+		versions = append(versions, formatFeatureVersion(v.Version)+"/"+v.Datacenter)
+	}
+	if strings.Join(versions, ",") != "1.3/texas,1.2/texas,0.9/" {
+		t.Errorf("unexpected versions %v", versions)
+	}
+	if len(r.Loadbalancers) != 1 || r.Loadbalancers[0].Guid != "lb1" {
+		t.Errorf("expected only the load balancer routing to the unit, got %+v", r.Loadbalancers)
+	}
+	dependents := []string{}
+	for _, d := range r.Dependents {
+		dependents = append(dependents, d.Guid)
+	}
+	// each dependent once, and never the unit's own stacks
+	if strings.Join(dependents, ",") != "cccccccccccc,dddddddddddd" {
+		t.Errorf("unexpected dependents %v", dependents)
+	}
+	if most != 2 {
+		t.Errorf("expected the stacks to be inspected two at a time, saw %d", most)
+	}
+}
+
+func TestInspectUnitFailsWithAStack(t *testing.T) {
+	inFlight, most := 0, 0
+	server := unitServer(t, "bbbbbbbbbbbb", &inFlight, &most)
+	defer server.Close()
+
+	c := client.New(server.URL, client.Session{})
+	c.Retries = 0
+	_, err := InspectUnit(context.Background(), c, "howdy-http", "texas", "dev", 2)
+	if !client.IsStatus(err, http.StatusInternalServerError) {
+		t.Errorf("expected the failing stack to fail the inspection, got %v", err)
+	}
+}
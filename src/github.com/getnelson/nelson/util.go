@@ -21,16 +21,20 @@ package main
 /// Because irony.
 
 import (
+	"context"
 	"fmt"
 	"github.com/briandowns/spinner"
 	humanize "github.com/dustin/go-humanize"
+	"github.com/getnelson/nelson/client"
 	"github.com/olekukonko/tablewriter"
-	"github.com/parnurzeal/gorequest"
+	"gopkg.in/urfave/cli.v1"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
 	"runtime"
+	"sync"
 	"time"
 )
 
@@ -42,34 +46,60 @@ func GetTimeout(input int) time.Duration {
 	}
 }
 
-func AugmentRequest(c *gorequest.SuperAgent, cfg *Config) *gorequest.SuperAgent {
-	return c.
-		AddCookie(cfg.GetAuthCookie()).
-		Set("Content-type", "application/json").
-		Set("User-Agent", UserAgentString(globalBuildVersion)).
-		Timeout(GetTimeout(globalTimeoutSeconds)).
-		Retry(3, 1*time.Second, http.StatusBadGateway, http.StatusInternalServerError).
-		SetCurlCommand(globalEnableCurl).
-		SetDebug(globalEnableDebug).
-		RedirectPolicy(func(req gorequest.Request, via []gorequest.Request) error {
-			// Copy the Cookie on redirect if the hosts match
-			last := via[0]
-			if req.URL.Host == last.URL.Host {
-				for attr, val := range via[0].Header {
-					if attr == "Cookie" {
-						if _, ok := req.Header[attr]; !ok {
-							req.Header[attr] = val
-						}
-					}
-				}
-			}
-			return nil
+// the insecure-skip-verify warning is printed once per invocation, however
+// many clients are made.
+var warnInsecure sync.Once
+
+// NewClient returns an api client for the given context, configured
+// from the global command line switches.
+func NewClient(cfg *Config) *client.Client {
+	c := client.New(cfg.Endpoint, client.Session{
+		SessionToken: cfg.ConfigSession.Token,
+		ExpiresAt:    cfg.ConfigSession.ExpiresAt,
+	})
+	transport, err := client.NewTransport(cfg.TLS.options(), cfg.Proxy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to configure the connection to "+cfg.Endpoint+": "+err.Error())
+		os.Exit(1)
+	}
+	if cfg.TLS.InsecureSkipVerify {
+		warnInsecure.Do(func() {
+			fmt.Fprintln(os.Stderr, "WARNING: TLS certificate verification is DISABLED for "+cfg.Endpoint+".")
+			fmt.Fprintln(os.Stderr, "WARNING: anyone on the network path can read and alter your traffic, session included.")
 		})
+	}
+	c.HTTPClient.Transport = transport
+	c.HTTPClient.Timeout = GetTimeout(globalTimeoutSeconds)
+	c.UserAgent = UserAgentString(globalBuildVersion)
+	c.Debug = globalEnableDebug
+	c.Curl = globalEnableCurl
+	c.DryRun = globalDryRun
+	c.Auth = cfg.Auth
+	// without a GITHUB_TOKEN there is nothing to renew the session with, so
+	// a 401 is left to fail the command rather than be reported twice
+	if (len(cfg.contextName) > 0 || cfg.fromEnvironment()) && canRenewSession() {
+		c.Renew = func(ctx context.Context) (client.Session, error) {
+			renewed, err := renewSession(ctx, cfg)
+			if err != nil {
+				return client.Session{}, err
+			}
+			*cfg = *renewed
+			return client.Session{SessionToken: renewed.Token, ExpiresAt: renewed.ExpiresAt}, nil
+		}
+	}
+	return c
 }
 
 func RenderTableToStdout(headers []string, data [][]string) {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader(headers)
+	renderTable(os.Stdout, headers, data)
+}
+
+// a table without headers when headers is empty.
+func renderTable(w io.Writer, headers []string, data [][]string) {
+	table := tablewriter.NewWriter(w)
+	if len(headers) > 0 {
+		table.SetHeader(headers)
+	}
 	table.SetBorders(tablewriter.Border{Left: false, Top: false, Right: false, Bottom: false})
 	table.SetHeaderLine(false)
 	table.SetRowLine(false)
@@ -122,8 +152,66 @@ func PrintTerminalErrors(errs []error) {
 	}
 
 	for _, e := range errs {
-		_, _ = fmt.Fprintln(os.Stderr, e)
+		_, _ = fmt.Fprintln(os.Stderr, formatTerminalError(e))
+	}
+}
+
+// api errors get a hint about what to do next, and with --debug the
+// raw response body so that unusual failures can be reported upstream.
+func formatTerminalError(err error) string {
+	e, ok := err.(*client.APIError)
+	if !ok {
+		return err.Error()
 	}
+	out := e.Error()
+	if hint := remediationHint(e); len(hint) > 0 {
+		out = out + "\n  hint: " + hint
+	}
+	if globalEnableDebug && len(e.Body) > 0 {
+		out = out + "\n  body: " + string(e.Body)
+	}
+	return out
+}
+
+func remediationHint(e *client.APIError) string {
+	if e.Err != nil {
+		return "The response was not in the expected format. Check that this CLI (" + CurrentVersion() + ") is compatible with the server using `nelson system version`."
+	}
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return "Your session is not valid. Run `nelson login` to start a new one."
+	case e.StatusCode == http.StatusForbidden:
+		return "You are not permitted to perform this operation. Check your access with a Nelson administrator."
+	case e.StatusCode == http.StatusNotFound:
+		return "Nothing matched the request. Check the GUID, name or namespace you supplied."
+	case e.StatusCode/100 == 4:
+		return "Nelson rejected the request as invalid. Check the flags and arguments you supplied."
+	case e.StatusCode/100 == 5:
+		return "Nelson server appears to be having trouble completing this request. Please seek assistance from an administrator."
+	}
+	return ""
+}
+
+// commandError turns the error a command failed with into its exit
+// error, printing it first. A dry run ending at its first mutation is not
+// a failure.
+func commandError(err error, message string, code int) error {
+	if err == client.ErrDryRun {
+		return endDryRun()
+	}
+	PrintTerminalError(err)
+	return cli.NewExitError(message, code)
+}
+
+// a dry run ends at the first mutation, which the client has already
+// printed in place of sending it; that is a success.
+func endDryRun() error {
+	fmt.Fprintln(os.Stderr, "===>> Dry run; nothing was sent to Nelson.")
+	return nil
+}
+
+func PrintTerminalError(err error) {
+	PrintTerminalErrors([]error{err})
 }
 
 func isValidGUID(in string) bool {
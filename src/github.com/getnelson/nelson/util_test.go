@@ -17,8 +17,11 @@
 package main
 
 import (
+	"errors"
 	"strings"
 	"testing"
+
+	"github.com/getnelson/nelson/client"
 )
 
 func TestUserAgentString(t *testing.T) {
@@ -38,3 +41,30 @@ func TestUserAgentString(t *testing.T) {
 		t.Error("devel user agent string is incorrect: \n" + result2 + "\n" + expectedDevelUserAgentString2)
 	}
 }
+
+func TestFormatTerminalError(t *testing.T) {
+	plain := errors.New("connection refused")
+	if formatTerminalError(plain) != "connection refused" {
+		t.Error("Expected plain errors to be printed as-is, but got", formatTerminalError(plain))
+	}
+
+	e := &client.APIError{StatusCode: 401, Method: "GET", URL: "https://nelson/v1/units", Message: "expired"}
+	expected := "Nelson responded to GET https://nelson/v1/units with 401 Unauthorized: expired\n  hint: Your session is not valid. Run `nelson login` to start a new one."
+	if formatTerminalError(e) != expected {
+		t.Error("Expected \n"+expected+"\nbut got:\n", formatTerminalError(e))
+	}
+}
+
+func TestNewClientRenewsOnlyWithAToken(t *testing.T) {
+	cfg := &Config{Endpoint: "https://nelson.example.com", contextName: "staging"}
+
+	t.Setenv("GITHUB_TOKEN", "")
+	if NewClient(cfg).Renew != nil {
+		t.Error("expected no session renewal without GITHUB_TOKEN")
+	}
+
+	t.Setenv("GITHUB_TOKEN", "abc")
+	if NewClient(cfg).Renew == nil {
+		t.Error("expected the session to be renewed with GITHUB_TOKEN")
+	}
+}
@@ -17,38 +17,49 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
-	"github.com/parnurzeal/gorequest"
-)
+	"fmt"
 
-type SessionResponse struct {
-	User User `json:"user"`
-}
+	"github.com/getnelson/nelson/client"
+)
 
-type User struct {
-	Login  string `json:"login"`
-	Name   string `json:"name"`
-	Avatar string `json:"avatar"`
+/*
+ * {
+ *   "user": { "login": "timperrett", "name": "Timothy Perrett", "avatar": "..." },
+ *   "endpoint": "https://nelson.yourcompany.com",
+ *   "source": "file",
+ *   "context": "staging",
+ *   "expires_at": 1467225866870,
+ *   "expires_in_seconds": 3540
+ * }
+ */
+type WhoAmIReport struct {
+	User             client.User `json:"user"`
+	Endpoint         string      `json:"endpoint"`
+	Source           string      `json:"source"`
+	Context          string      `json:"context,omitempty"`
+	ExpiresAt        int64       `json:"expires_at"`
+	ExpiresInSeconds int64       `json:"expires_in_seconds"`
 }
 
-// GET /session
-func WhoAmI(http *gorequest.SuperAgent, cfg *Config) (resp SessionResponse, err []error) {
-	r, bytes, errs := AugmentRequest(
-		http.Get(cfg.Endpoint+"/session"), cfg).EndBytes()
-
-	if errs != nil {
-		return SessionResponse{}, errs
+func PrintWhoAmI(r WhoAmIReport) {
+	fmt.Println("===>> Currently logged in to " + r.User.Name + " @ " + r.Endpoint)
+	fmt.Println("===>> Using " + describeConfigSource(r.Source, r.Context))
+	if r.ExpiresAt > 0 {
+		fmt.Println("===>> Session expires " + javaEpochToHumanizedTime(r.ExpiresAt) + " (" + JavaEpochToDateStr(r.ExpiresAt) + ")")
+	} else {
+		fmt.Println("===>> Session expiry is unknown")
 	}
+}
 
-	if r.StatusCode/100 != 2 {
-		errs = append(errs, errors.New("Bad response from Nelson server"))
-		return SessionResponse{}, errs
-	} else {
-		var resp SessionResponse
-		if err := json.Unmarshal(bytes, &resp); err != nil {
-			panic(err)
-		}
-		return resp, errs
+func describeConfigSource(source string, context string) string {
+	switch source {
+	case configSourceFlag:
+		return "context '" + context + "' named by --context"
+	case configSourceSessionToken:
+		return "the session in $NELSON_SESSION_TOKEN, for $NELSON_ADDR"
+	case configSourceGithubToken:
+		return "a session created from $GITHUB_TOKEN, for $NELSON_ADDR (not saved)"
+	default:
+		return "context '" + context + "' from the config file"
 	}
 }